@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/binary-gws/agent/internal/config"
+	"github.com/binary-gws/agent/internal/enrollment"
+	"github.com/binary-gws/agent/internal/identity"
+	"github.com/binary-gws/agent/internal/platform"
+	"github.com/binary-gws/agent/internal/transport"
+)
+
+// runEnroll implements "gw-agent enroll": it exchanges a bootstrap code for
+// the gateway identity and token and stores them under data_dir.
+func runEnroll(args []string) int {
+	fs := flag.NewFlagSet("enroll", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/gw-agent/config.yaml", "Path to configuration file")
+	code := fs.String("code", "", "One-time bootstrap code (or GW_AGENT_BOOTSTRAP_CODE)")
+	enrollURL := fs.String("url", "", "Registration endpoint (default: enrollment.url from config)")
+	force := fs.Bool("force", false, "Replace an existing enrollment")
+	fs.Parse(args)
+
+	if *code == "" {
+		*code = os.Getenv("GW_AGENT_BOOTSTRAP_CODE")
+	}
+	if *code == "" {
+		fmt.Fprintln(os.Stderr, "Enrollment requires --code")
+		return 2
+	}
+
+	cfg, err := config.Parse(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if *enrollURL == "" {
+		*enrollURL = cfg.Enrollment.URL
+	}
+	if *enrollURL == "" {
+		fmt.Fprintln(os.Stderr, "Enrollment requires --url or enrollment.url in the config")
+		return 2
+	}
+
+	dataDir := cfg.StateDir()
+	existing, err := enrollment.Load(dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read existing enrollment: %v\n", err)
+		return 1
+	}
+	if existing != nil && !*force {
+		fmt.Fprintf(os.Stderr, "Gateway is already enrolled as %s; use --force to replace it\n", existing.UUID)
+		return 1
+	}
+
+	tlsConfig, err := transport.NewPinnedTLSConfig(cfg.TLS.CABundlePath, cfg.TLS.InsecureSkipVerify, cfg.TLS.SPKIPins, *enrollURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to configure TLS: %v\n", err)
+		return 1
+	}
+	client := transport.NewHTTPClient(tlsConfig, 30*time.Second)
+
+	deviceID, err := identity.LoadOrCreate(dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load device key: %v\n", err)
+		return 1
+	}
+
+	hostname, _ := os.Hostname()
+	req := enrollment.Request{
+		BootstrapCode: *code,
+		Hostname:      hostname,
+		Platform:      platform.Detect(cfg.Platform.PlatformOverride).Platform,
+		AgentVersion:  Version,
+		PublicKey:     deviceID.PublicKey(),
+		KeyAlgorithm:  identity.Algorithm,
+		KeyID:         deviceID.KeyID(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	state, err := enrollment.Enroll(ctx, client, *enrollURL, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Enrollment failed: %v\n", err)
+		return 1
+	}
+	if err := enrollment.Save(dataDir, state); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save enrollment: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Enrolled gateway %s (client %s, site %s)\n", state.UUID, state.ClientID, state.SiteID)
+	fmt.Printf("Device key %s registered\n", deviceID.KeyID())
+	fmt.Printf("State written to %s\n", dataDir)
+	return 0
+}
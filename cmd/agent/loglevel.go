@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/binary-gws/agent/internal/config"
+	"github.com/binary-gws/agent/internal/control"
+	"github.com/binary-gws/agent/internal/logging"
+)
+
+// runLogLevel implements "gw-agent log-level": it shows or changes the log
+// level of the running agent through its control socket.
+func runLogLevel(args []string) int {
+	fs := flag.NewFlagSet("log-level", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/gw-agent/config.yaml", "Path to configuration file")
+	socket := fs.String("socket", "", "Control socket (default: control.sock in data_dir)")
+	duration := fs.Duration("for", logging.DefaultLevelTimeout, "How long before the level reverts")
+	fs.Parse(args)
+	// Accept flags after the level too, as in "log-level debug --for 1h".
+	var level string
+	if fs.NArg() > 0 {
+		level = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+	if _, ok := logging.LookupLevel(level); level != "" && level != "reset" && !ok {
+		fmt.Fprintf(os.Stderr, "Unknown level %q; use debug, info, warn, error or reset\n", level)
+		return 2
+	}
+
+	if *socket == "" {
+		cfg, err := config.Parse(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+			return 1
+		}
+		*socket = control.SocketPath(cfg.StateDir())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := control.NewClient(*socket)
+	var status *control.LogLevel
+	var err error
+	if level == "" {
+		status, err = client.LogLevel(ctx)
+	} else {
+		status, err = client.SetLogLevel(ctx, level, *duration)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	if status.RevertAt != nil {
+		fmt.Printf("%s until %s, then %s\n", status.Level, status.RevertAt.Local().Format(time.RFC3339), status.BaseLevel)
+	} else {
+		fmt.Println(status.Level)
+	}
+	return 0
+}
+
+// watchLevelSignals makes the log level one step more verbose on SIGUSR1
+// and one step less verbose on SIGUSR2, reverting after
+// logging.DefaultLevelTimeout.
+func watchLevelSignals(ctx context.Context, signals <-chan os.Signal, logger *logging.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			level := logger.StepLevel(levelSignalStep(sig), logging.DefaultLevelTimeout)
+			fields := map[string]interface{}{
+				"signal":    sig.String(),
+				"log_level": level.String(),
+			}
+			if base, revertAt, ok := logger.TemporaryLevel(); ok {
+				fields["revert_to"] = base.String()
+				fields["revert_at"] = revertAt.UTC().Format(time.RFC3339)
+			}
+			logger.Warn("Log level changed by signal", fields)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/binary-gws/agent/internal/config"
+	"github.com/binary-gws/agent/internal/logging"
+)
+
+// logOutputs are the destinations configured under logging besides the
+// logger's level. They are opened before the logger exists, so failures are
+// collected and logged once it does.
+type logOutputs struct {
+	writer  io.Writer
+	sinks   []logging.Sink
+	closers []io.Closer
+	errs    []logOutputError
+}
+
+type logOutputError struct {
+	output string
+	target string
+	err    error
+}
+
+func openLogOutputs(cfg *config.Config) *logOutputs {
+	o := &logOutputs{}
+	writers := []io.Writer{}
+
+	if cfg.Logging.Journald {
+		journal, err := logging.OpenJournal("gw-agent")
+		if err != nil {
+			o.errs = append(o.errs, logOutputError{"journald", logging.JournalSocket, err})
+		} else {
+			o.sinks = append(o.sinks, journal)
+			o.closers = append(o.closers, journal)
+		}
+	}
+	// Under systemd stdout already goes to the journal; writing JSON lines
+	// there too would log every entry twice.
+	if len(o.sinks) == 0 || !logging.StdoutIsJournal() {
+		writers = append(writers, os.Stdout)
+	}
+
+	if sc := cfg.Logging.Syslog; sc.Address != "" {
+		// Validate has checked the facility.
+		facility, _ := logging.ParseFacility(sc.Facility)
+		syslog, err := logging.OpenSyslog(logging.SyslogConfig{
+			Network:  sc.Network,
+			Address:  sc.Address,
+			Facility: facility,
+			Tag:      sc.Tag,
+		})
+		if err != nil {
+			o.errs = append(o.errs, logOutputError{"syslog", sc.Network + ":" + sc.Address, err})
+		} else {
+			o.sinks = append(o.sinks, syslog)
+			o.closers = append(o.closers, syslog)
+		}
+	}
+
+	if fc := cfg.Logging.File; fc.Path != "" {
+		logFile, err := logging.OpenRotatingFile(logging.RotateConfig{
+			Path:     fc.Path,
+			MaxSize:  int64(rotateLimit(fc.MaxSizeMB)) << 20,
+			MaxAge:   time.Duration(rotateLimit(fc.MaxAgeHours)) * time.Hour,
+			MaxFiles: rotateLimit(fc.MaxFiles),
+			Compress: strings.EqualFold(fc.Compress, "gzip"),
+		})
+		if err != nil {
+			o.errs = append(o.errs, logOutputError{"file", fc.Path, err})
+		} else {
+			writers = append(writers, logFile)
+			o.closers = append(o.closers, logFile)
+		}
+	}
+
+	switch len(writers) {
+	case 0:
+		o.writer = io.Discard
+	case 1:
+		o.writer = writers[0]
+	default:
+		o.writer = io.MultiWriter(writers...)
+	}
+	return o
+}
+
+// rotateLimit maps a logging.file limit to RotateConfig, where -1 (no
+// limit) becomes zero.
+func rotateLimit(v int) int {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// attach adds the sinks to logger and logs the outputs that failed to open.
+// The agent keeps running with the rest.
+func (o *logOutputs) attach(logger *logging.Logger) {
+	for _, s := range o.sinks {
+		logger.AddSink(s)
+	}
+	for _, e := range o.errs {
+		logger.Error("Failed to open log output", map[string]interface{}{
+			"output": e.output,
+			"target": e.target,
+			"error":  e.err.Error(),
+		})
+	}
+}
+
+// rateLimits converts logging.rate_limit for Logger.SetRateLimits.
+func rateLimits(cfg *config.Config) map[logging.Level]logging.RateLimit {
+	rl := cfg.Logging.RateLimit
+	if rl.Disabled {
+		return nil
+	}
+	convert := func(l config.RateLimit) logging.RateLimit {
+		return logging.RateLimit{Window: time.Duration(l.WindowSeconds) * time.Second, Burst: l.Burst}
+	}
+	return map[logging.Level]logging.RateLimit{
+		logging.LevelDebug: convert(rl.Debug),
+		logging.LevelInfo:  convert(rl.Info),
+		logging.LevelWarn:  convert(rl.Warn),
+		logging.LevelError: convert(rl.Error),
+	}
+}
+
+func (o *logOutputs) Close() {
+	for _, c := range o.closers {
+		c.Close()
+	}
+}
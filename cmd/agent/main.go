@@ -10,10 +10,16 @@ import (
 
 	"github.com/binary-gws/agent/internal/collector"
 	"github.com/binary-gws/agent/internal/config"
+	"github.com/binary-gws/agent/internal/control"
+	"github.com/binary-gws/agent/internal/credentials"
+	"github.com/binary-gws/agent/internal/identity"
 	"github.com/binary-gws/agent/internal/logging"
 	"github.com/binary-gws/agent/internal/platform"
+	"github.com/binary-gws/agent/internal/remoteconfig"
 	"github.com/binary-gws/agent/internal/scheduler"
+	"github.com/binary-gws/agent/internal/session"
 	"github.com/binary-gws/agent/internal/transport"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -23,11 +29,23 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "enroll":
+			os.Exit(runEnroll(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		case "log-level":
+			os.Exit(runLogLevel(os.Args[2:]))
+		}
+	}
+
 	configPath := flag.String("config", "/etc/gw-agent/config.yaml", "Path to configuration file")
 	once := flag.Bool("once", false, "Send one heartbeat and exit")
-	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	logLevel := flag.String("log-level", "", "Log level (debug, info, warn, error); overrides logging.level")
 	dryRun := flag.Bool("dry-run", false, "Build payload and print to stdout without sending")
 	printVersion := flag.Bool("print-version", false, "Print version information and exit")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit")
 	flag.Parse()
 
 	if *printVersion {
@@ -44,28 +62,103 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger := logging.New(logging.ParseLevel(*logLevel), os.Stdout, cfg.UUID)
+	logLevelSet := *logLevel != ""
+	if logLevelSet {
+		cfg.Logging.Level = *logLevel
+	}
+
+	if *printConfig {
+		doc, err := cfg.Annotated()
+		if err == nil {
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			err = enc.Encode(doc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	logOutputs := openLogOutputs(cfg)
+	defer logOutputs.Close()
+
+	logger := logging.New(logging.ParseLevel(cfg.Logging.Level), logOutputs.writer, cfg.UUID)
+	logFormat, _ := logging.ParseFormat(cfg.Logging.Format)
+	logger.SetFormat(logFormat)
+	logger.Redact(cfg.Secrets()...)
+	logger.SetRateLimits(rateLimits(cfg))
+	recentLogs := logging.NewRecent(cfg.Logging.Heartbeat.MaxEntries)
+	logger.AddSink(recentLogs)
+	logOutputs.attach(logger)
 
 	platformInfo := platform.Detect(cfg.Platform.PlatformOverride)
 	logger.Info("Starting Gateway Agent", map[string]interface{}{
-		"version":   Version,
-		"commit":    Commit,
-		"platform":  platformInfo.Platform,
-		"os":        platformInfo.OS,
-		"arch":      platformInfo.Arch,
-		"config":    *configPath,
+		"version":    Version,
+		"commit":     Commit,
+		"platform":   platformInfo.Platform,
+		"os":         platformInfo.OS,
+		"arch":       platformInfo.Arch,
+		"hypervisor": platformInfo.Hypervisor,
+		"container":  platformInfo.Container,
+		"wsl":        platformInfo.WSL,
+		"cloud":      platformInfo.Cloud,
+		"os_release": platformInfo.Identity.OSPrettyName,
+		"model":      platformInfo.Identity.Model,
+		"config":     *configPath,
+	})
+
+	sessionStore := session.NewStore(cfg.DataDir)
+	previousSession, err := sessionStore.Load()
+	if err != nil {
+		logger.Warn("Failed to load previous session", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	currentSession, err := session.New()
+	if err != nil {
+		logger.Error("Failed to create session", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if !*dryRun {
+		if err := sessionStore.Start(currentSession); err != nil {
+			logger.Warn("Failed to persist session", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	logger.Info("Session started", map[string]interface{}{
+		"session_id": currentSession.ID,
+		"restart":    previousSession != nil,
 	})
 
+	// The device key is created on first run; dry runs never send, so they
+	// do not need one.
+	var signer transport.Signer
+	if !*dryRun {
+		deviceID, err := identity.LoadOrCreate(cfg.DataDir)
+		if err != nil {
+			logger.Error("Failed to load device key", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		signer = deviceID
+		logger.Info("Loaded device key", map[string]interface{}{
+			"key_id": deviceID.KeyID(),
+		})
+	}
+
 	collector := collector.New(cfg.Intervals.ComputeSeconds)
+	collector.SetMonitoredProcesses(cfg.Monitoring.Processes)
+	if platformInfo.Identity.IsRaspberryPi() {
+		collector.EnableRaspberryPi()
+	}
 
-	apiURLs := append([]string{cfg.APIURL}, cfg.APIURLFallbacks...)
-	transportClient, err := transport.New(transport.Config{
-		APIURLs:            apiURLs,
-		TokenCurrent:       cfg.Auth.TokenCurrent,
-		TokenGrace:         cfg.Auth.TokenGrace,
-		CABundlePath:       cfg.TLS.CABundlePath,
-		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
-	})
+	transportClient, err := transport.New(transportConfig(cfg, signer))
 	if err != nil {
 		logger.Error("Failed to create transport client", map[string]interface{}{
 			"error": err.Error(),
@@ -73,19 +166,79 @@ func main() {
 		os.Exit(1)
 	}
 
+	tokenStore, err := credentials.Open(cfg.DataDir, cfg.Auth.TokenCurrent)
+	if err != nil {
+		logger.Warn("Failed to load rotated tokens, using config tokens", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if current, grace, ok := tokenStore.Tokens(); ok {
+		logger.Redact(current, grace)
+		transportClient.SetTokens(current, grace)
+		logger.Info("Using tokens issued by backend rotation", map[string]interface{}{
+			"token_fingerprint": credentials.Fingerprint(current),
+			"rotation_pending":  grace != "",
+		})
+	}
+
+	remoteStore, err := remoteconfig.Open(cfg.DataDir)
+	if err != nil {
+		logger.Warn("Failed to load remote config state", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	reload := &reloader{
+		path:          *configPath,
+		logLevelFlag:  logLevelSet,
+		cfg:           cfg,
+		logger:        logger.With("component", "reload"),
+		collector:     collector,
+		transport:     transportClient,
+		remote:        remoteStore,
+		fetchRequests: make(chan struct{}, 1),
+		heartbeats:    make(chan error, 16),
+	}
+	// Single heartbeats never fetch bundles or confirm them.
+	var remoteConfig scheduler.RemoteConfig
+	if !*once && !*dryRun {
+		remoteConfig = reload
+	}
+
 	sched := scheduler.New(scheduler.Config{
-		UUID:             cfg.UUID,
-		ClientID:         cfg.ClientID,
-		SiteID:           cfg.SiteID,
-		Platform:         platformInfo,
-		HeartbeatSeconds: cfg.Intervals.HeartbeatSeconds,
-		Collector:        collector,
-		Transport:        transportClient,
-		Logger:           logger,
-		Version:          Version,
-		Commit:           Commit,
-		BuildDate:        BuildDate,
+		UUID:               cfg.UUID,
+		ClientID:           cfg.ClientID,
+		SiteID:             cfg.SiteID,
+		Platform:           platformInfo,
+		HeartbeatSeconds:   cfg.Intervals.HeartbeatSeconds,
+		Collector:          collector,
+		Transport:          transportClient,
+		Logger:             logger.With("component", "scheduler"),
+		Version:            Version,
+		Commit:             Commit,
+		BuildDate:          BuildDate,
+		PayloadMode:        cfg.Payload.Mode,
+		FullSnapshotEvery:  cfg.Payload.FullSnapshotEvery,
+		Session:            currentSession,
+		PreviousSession:    previousSession,
+		TokenStore:         tokenStore,
+		ConfigToken:        cfg.Auth.TokenCurrent,
+		RemoteConfig:       remoteConfig,
+		RecentLogs:         recentLogs,
+		LogEntriesMaxBytes: cfg.Logging.Heartbeat.MaxBytes,
+		ReadIdentity:       platform.ReadIdentity,
 	})
+	reload.sched = sched
+
+	endSession := func() {
+		if *dryRun {
+			return
+		}
+		if err := sessionStore.End(currentSession, sched.BatchIndex()); err != nil {
+			logger.Warn("Failed to persist session", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -94,7 +247,9 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	if *once || *dryRun {
-		if err := sched.SendOnce(ctx, *dryRun); err != nil {
+		err := sched.SendOnce(ctx, *dryRun)
+		endSession()
+		if err != nil {
 			logger.Error("Failed to send heartbeat", map[string]interface{}{
 				"error": err.Error(),
 			})
@@ -110,7 +265,26 @@ func main() {
 		cancel()
 	}()
 
-	if err := sched.Run(ctx); err != nil && err != context.Canceled {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go reload.run(ctx, hupChan)
+
+	levelChan := make(chan os.Signal, 1)
+	notifyLevelSignals(levelChan)
+	go watchLevelSignals(ctx, levelChan, logger)
+
+	ctrl, err := control.Listen(control.SocketPath(cfg.DataDir), logger.With("component", "control"))
+	if err != nil {
+		logger.Warn("Control socket unavailable", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		go ctrl.Serve(ctx)
+	}
+
+	err = sched.Run(ctx)
+	endSession()
+	if err != nil && err != context.Canceled {
 		logger.Error("Scheduler error", map[string]interface{}{
 			"error": err.Error(),
 		})
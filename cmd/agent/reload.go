@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/binary-gws/agent/internal/collector"
+	"github.com/binary-gws/agent/internal/config"
+	"github.com/binary-gws/agent/internal/logging"
+	"github.com/binary-gws/agent/internal/remoteconfig"
+	"github.com/binary-gws/agent/internal/scheduler"
+	"github.com/binary-gws/agent/internal/secrets"
+	"github.com/binary-gws/agent/internal/transport"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 5 * time.Second
+
+// reloader re-reads the config on SIGHUP or when it or a drop-in changes and
+// applies what can change without a restart. It also re-reads tokens from
+// external sources and fetches remote config bundles. Apart from the
+// channels and the remote config store, all of its state is owned by the
+// run goroutine.
+type reloader struct {
+	path         string
+	logLevelFlag bool
+
+	cfg       *config.Config
+	logger    *logging.Logger
+	collector *collector.Collector
+	transport *transport.Client
+	sched     *scheduler.Scheduler
+
+	watcher *secrets.Watcher
+	stamp   configStamp
+
+	remote         *remoteconfig.Store
+	fetchRequests  chan struct{}
+	heartbeats     chan error
+	remoteFailures int
+}
+
+// configStamp summarises the size and modification time of the config
+// file and its drop-ins; any change, including an added or removed
+// drop-in, triggers a reload.
+type configStamp string
+
+func transportConfig(cfg *config.Config, signer transport.Signer) transport.Config {
+	return transport.Config{
+		APIURLs:             append([]string{cfg.APIURL}, cfg.APIURLFallbacks...),
+		TokenCurrent:        cfg.Auth.TokenCurrent,
+		TokenGrace:          cfg.Auth.TokenGrace,
+		CABundlePath:        cfg.TLS.CABundlePath,
+		InsecureSkipVerify:  cfg.TLS.InsecureSkipVerify,
+		SPKIPins:            cfg.TLS.SPKIPins,
+		Compression:         cfg.Compression.Algorithm,
+		CompressionMinBytes: cfg.Compression.MinBytes,
+		Signer:              signer,
+	}
+}
+
+func newTokenWatcher(cfg *config.Config) *secrets.Watcher {
+	if !cfg.Auth.CurrentSource().External() && !cfg.Auth.GraceSource().External() {
+		return nil
+	}
+	return secrets.NewWatcher(
+		[]secrets.Source{cfg.Auth.CurrentSource(), cfg.Auth.GraceSource()},
+		[]string{cfg.Auth.TokenCurrent, cfg.Auth.TokenGrace},
+	)
+}
+
+func statConfig(path string) configStamp {
+	files, err := config.Files(path)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return configStamp(b.String())
+}
+
+func (r *reloader) run(ctx context.Context, hup <-chan os.Signal) {
+	r.watcher = newTokenWatcher(r.cfg)
+	r.stamp = statConfig(r.path)
+
+	poll := time.NewTicker(configPollInterval)
+	defer poll.Stop()
+	refreshInterval := time.Duration(r.cfg.Auth.RefreshSeconds) * time.Second
+	refresh := time.NewTicker(refreshInterval)
+	defer refresh.Stop()
+	remoteInterval := time.Duration(r.cfg.RemoteConfig.PollSeconds) * time.Second
+	remotePoll := time.NewTicker(remoteInterval)
+	defer remotePoll.Stop()
+
+	r.fetchRemoteConfig(ctx, "startup")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.stamp = statConfig(r.path)
+			r.reload("sighup")
+		case <-poll.C:
+			if stamp := statConfig(r.path); stamp != r.stamp {
+				r.stamp = stamp
+				r.reload("file_changed")
+			}
+		case <-refresh.C:
+			r.refreshTokens(ctx)
+		case <-remotePoll.C:
+			r.fetchRemoteConfig(ctx, "poll")
+		case <-r.fetchRequests:
+			r.fetchRemoteConfig(ctx, "directive")
+		case err := <-r.heartbeats:
+			r.heartbeatResult(err)
+		}
+
+		if next := time.Duration(r.cfg.Auth.RefreshSeconds) * time.Second; next != refreshInterval {
+			refreshInterval = next
+			refresh.Reset(refreshInterval)
+		}
+		if next := time.Duration(r.cfg.RemoteConfig.PollSeconds) * time.Second; next != remoteInterval {
+			remoteInterval = next
+			remotePoll.Reset(remoteInterval)
+		}
+	}
+}
+
+// reload loads and validates the config file and applies it. An invalid
+// config is rejected as a whole and the last good one stays in effect.
+func (r *reloader) reload(reason string) {
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		r.logger.Error("Config reload rejected, keeping last good config", map[string]interface{}{
+			"reason": reason,
+			"error":  err.Error(),
+		})
+		return
+	}
+	r.apply(cfg, reason)
+}
+
+// apply switches to cfg, which has already been validated. It fails, with
+// nothing changed, only if the new transport settings cannot be loaded.
+func (r *reloader) apply(cfg *config.Config, reason string) error {
+	r.logger.Redact(cfg.Secrets()...)
+	old := r.cfg
+
+	var applied []string
+
+	// Transport settings are applied first: they are the only part that can
+	// still fail, and nothing has changed yet if they do.
+	oldTransport, newTransport := transportConfig(old, nil), transportConfig(cfg, nil)
+	oldTransport.TokenCurrent, oldTransport.TokenGrace = "", ""
+	newTransport.TokenCurrent, newTransport.TokenGrace = "", ""
+	if !reflect.DeepEqual(oldTransport, newTransport) {
+		if err := r.transport.Reconfigure(newTransport); err != nil {
+			r.logger.Error("Config reload rejected, keeping last good config", map[string]interface{}{
+				"reason": reason,
+				"error":  err.Error(),
+			})
+			return err
+		}
+		applied = append(applied, "endpoints")
+	}
+
+	if cfg.Auth.TokenCurrent != old.Auth.TokenCurrent || cfg.Auth.TokenGrace != old.Auth.TokenGrace {
+		r.sched.UpdateConfigTokens(cfg.Auth.TokenCurrent, cfg.Auth.TokenGrace)
+		applied = append(applied, "auth")
+	}
+	r.watcher = newTokenWatcher(cfg)
+
+	if cfg.Intervals.HeartbeatSeconds != old.Intervals.HeartbeatSeconds {
+		r.sched.SetHeartbeatInterval(time.Duration(cfg.Intervals.HeartbeatSeconds) * time.Second)
+		applied = append(applied, "intervals.heartbeat_seconds")
+	}
+	if cfg.Intervals.ComputeSeconds != old.Intervals.ComputeSeconds {
+		r.collector.SetComputeInterval(cfg.Intervals.ComputeSeconds)
+		applied = append(applied, "intervals.compute_seconds")
+	}
+	if !slices.Equal(cfg.Monitoring.Processes, old.Monitoring.Processes) {
+		r.collector.SetMonitoredProcesses(cfg.Monitoring.Processes)
+		applied = append(applied, "monitoring.processes")
+	}
+	if cfg.Logging.Level != old.Logging.Level && !r.logLevelFlag {
+		r.logger.SetLevel(logging.ParseLevel(cfg.Logging.Level))
+		applied = append(applied, "logging.level")
+	}
+	if cfg.Logging.Format != old.Logging.Format {
+		format, _ := logging.ParseFormat(cfg.Logging.Format)
+		r.logger.SetFormat(format)
+		applied = append(applied, "logging.format")
+	}
+	if cfg.Logging.RateLimit != old.Logging.RateLimit {
+		r.logger.SetRateLimits(rateLimits(cfg))
+		applied = append(applied, "logging.rate_limit")
+	}
+
+	var restartRequired []string
+	if cfg.UUID != old.UUID || cfg.ClientID != old.ClientID || cfg.SiteID != old.SiteID {
+		restartRequired = append(restartRequired, "identity")
+	}
+	if cfg.DataDir != old.DataDir {
+		restartRequired = append(restartRequired, "data_dir")
+	}
+	if cfg.Payload != old.Payload {
+		restartRequired = append(restartRequired, "payload")
+	}
+	if cfg.Platform != old.Platform {
+		restartRequired = append(restartRequired, "platform")
+	}
+	if cfg.Logging.File != old.Logging.File {
+		restartRequired = append(restartRequired, "logging.file")
+	}
+	if cfg.Logging.Journald != old.Logging.Journald {
+		restartRequired = append(restartRequired, "logging.journald")
+	}
+	if cfg.Logging.Syslog != old.Logging.Syslog {
+		restartRequired = append(restartRequired, "logging.syslog")
+	}
+	if cfg.Logging.Heartbeat != old.Logging.Heartbeat {
+		restartRequired = append(restartRequired, "logging.heartbeat")
+	}
+
+	r.cfg = cfg
+
+	fields := map[string]interface{}{
+		"reason":  reason,
+		"applied": applied,
+	}
+	if len(restartRequired) > 0 {
+		fields["restart_required"] = restartRequired
+		r.logger.Warn("Config reloaded, some changes need a restart", fields)
+		return nil
+	}
+	r.logger.Info("Config reloaded", fields)
+	return nil
+}
+
+// refreshTokens re-reads tokens from their file, environment or command
+// sources and hands changes to the scheduler.
+func (r *reloader) refreshTokens(ctx context.Context) {
+	if r.watcher == nil {
+		return
+	}
+	changed, err := r.watcher.Refresh(ctx)
+	if err != nil {
+		r.logger.Warn("Failed to refresh tokens, keeping previous values", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !changed {
+		return
+	}
+	values := r.watcher.Values()
+	r.logger.Redact(values...)
+	r.sched.UpdateConfigTokens(values[0], values[1])
+	r.cfg.Auth.TokenCurrent, r.cfg.Auth.TokenGrace = values[0], values[1]
+}
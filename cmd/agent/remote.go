@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/binary-gws/agent/internal/config"
+	"github.com/binary-gws/agent/internal/remoteconfig"
+)
+
+// RequestFetch implements scheduler.RemoteConfig.
+func (r *reloader) RequestFetch() {
+	select {
+	case r.fetchRequests <- struct{}{}:
+	default:
+	}
+}
+
+// HeartbeatResult implements scheduler.RemoteConfig. Results are dropped
+// rather than blocking the scheduler if the run goroutine falls behind.
+func (r *reloader) HeartbeatResult(err error) {
+	select {
+	case r.heartbeats <- err:
+	default:
+	}
+}
+
+// Status implements scheduler.RemoteConfig.
+func (r *reloader) Status() *remoteconfig.Status {
+	return r.remote.Status()
+}
+
+// fetchRemoteConfig fetches the config bundle and applies it if it is newer
+// than any seen before, correctly signed and valid.
+func (r *reloader) fetchRemoteConfig(ctx context.Context, reason string) {
+	if r.cfg.RemoteConfig.URL == "" {
+		return
+	}
+	err := r.updateRemoteConfig(ctx)
+	r.remote.SetError(err)
+	if err != nil {
+		r.logger.Warn("Remote config update failed", map[string]interface{}{
+			"reason": reason,
+			"error":  err.Error(),
+		})
+	}
+}
+
+func (r *reloader) updateRemoteConfig(ctx context.Context) error {
+	rc := r.cfg.RemoteConfig
+	state := r.remote.State()
+
+	header := http.Header{}
+	header.Set("If-None-Match", fmt.Sprintf(`"%d"`, state.HighestVersion))
+	resp, err := r.transport.Fetch(ctx, rc.URL, header)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config bundle: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	bundle, err := remoteconfig.Parse(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bundle.Version <= state.HighestVersion {
+		return nil
+	}
+	key, err := remoteconfig.ParsePublicKey(rc.PublicKey)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Verify(key); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadWithOverlay(r.path, bundle)
+	if err != nil {
+		if rerr := r.remote.Reject(bundle.Version); rerr != nil {
+			return rerr
+		}
+		return fmt.Errorf("config bundle v%d rejected: %w", bundle.Version, err)
+	}
+	if err := r.remote.Activate(bundle); err != nil {
+		return err
+	}
+	r.remoteFailures = 0
+	r.logger.Info("Applying remote config", map[string]interface{}{
+		"version": bundle.Version,
+	})
+	if err := r.apply(cfg, "remote_config"); err != nil {
+		r.rollbackRemoteConfig("apply_failed")
+		return fmt.Errorf("%s could not be applied: %w", bundle.Label(), err)
+	}
+	return nil
+}
+
+// heartbeatResult confirms an overlay on probation after a successful
+// heartbeat, or rolls it back after rollback_after_failures failed ones in
+// a row.
+func (r *reloader) heartbeatResult(err error) {
+	if !r.remote.Pending() {
+		r.remoteFailures = 0
+		return
+	}
+	if err == nil {
+		r.remoteFailures = 0
+		if err := r.remote.Confirm(); err != nil {
+			r.logger.Warn("Failed to persist remote config state", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		r.logger.Info("Remote config confirmed by successful heartbeat", map[string]interface{}{
+			"version": r.remote.State().Active.Version,
+		})
+		return
+	}
+
+	r.remoteFailures++
+	if r.remoteFailures < r.cfg.RemoteConfig.RollbackAfterFailures {
+		return
+	}
+	r.remoteFailures = 0
+	r.rollbackRemoteConfig("heartbeat_failures")
+}
+
+func (r *reloader) rollbackRemoteConfig(reason string) {
+	version, err := r.remote.Rollback()
+	if err != nil {
+		r.logger.Error("Failed to roll back remote config", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	fields := map[string]interface{}{
+		"reason":              reason,
+		"rolled_back_version": version,
+	}
+	if active := r.remote.State().Active; active != nil {
+		fields["version"] = active.Version
+	}
+	r.logger.Warn("Rolled back remote config to last known-good", fields)
+	r.reload("remote_config_rollback")
+}
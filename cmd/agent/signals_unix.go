@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyLevelSignals(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+}
+
+func levelSignalStep(sig os.Signal) int {
+	if sig == syscall.SIGUSR1 {
+		return -1
+	}
+	return 1
+}
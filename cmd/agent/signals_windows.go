@@ -0,0 +1,10 @@
+package main
+
+import "os"
+
+// Windows has no SIGUSR1 or SIGUSR2; use "gw-agent log-level" instead.
+func notifyLevelSignals(c chan<- os.Signal) {}
+
+func levelSignalStep(sig os.Signal) int {
+	return 0
+}
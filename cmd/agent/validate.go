@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/binary-gws/agent/internal/config"
+)
+
+// runConfig implements "gw-agent config <subcommand>".
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: gw-agent config validate [--config PATH] [--skip-secrets] [--warnings-as-errors]")
+		return 2
+	}
+	return runValidate(args[1:])
+}
+
+// runValidate checks the config file and its drop-ins without starting the
+// agent. It exits 1 when there are errors, or warnings with
+// --warnings-as-errors.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/gw-agent/config.yaml", "Path to configuration file")
+	skipSecrets := fs.Bool("skip-secrets", false, "Do not read token files, variables or commands")
+	warningsAsErrors := fs.Bool("warnings-as-errors", false, "Exit non-zero on warnings")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+
+	diags := config.Check(*configPath, config.CheckOptions{SkipSecrets: *skipSecrets})
+	var errs, warnings int
+	for _, d := range diags {
+		fmt.Println(d)
+		if d.Severity == config.SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Printf("%s: %d %s, %d %s\n", *configPath, errs, plural(errs, "error"), warnings, plural(warnings, "warning"))
+
+	if errs > 0 || (*warningsAsErrors && warnings > 0) {
+		return 1
+	}
+	return 0
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
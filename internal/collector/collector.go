@@ -26,6 +26,7 @@ type ComputeMetrics struct {
 	Disk        *DiskMetrics        `json:"disk,omitempty"`
 	Temperature *TemperatureMetrics `json:"temperature,omitempty"`
 	Process     *ProcessMetrics     `json:"process,omitempty"`
+	RaspberryPi *RaspberryPiMetrics `json:"raspberry_pi,omitempty"`
 }
 
 type CPUMetrics struct {
@@ -102,6 +103,9 @@ type Collector struct {
 
 	// Process monitoring
 	monitoredProcessNames []string
+
+	// raspberryPi is set by EnableRaspberryPi.
+	raspberryPi *raspberryPi
 }
 
 func New(computeIntervalSeconds int) *Collector {
@@ -155,6 +159,16 @@ func (c *Collector) GetComputeMetrics(force bool) *ComputeMetrics {
 		hasAnyMetric = true
 	}
 
+	c.mu.RLock()
+	pi := c.raspberryPi
+	c.mu.RUnlock()
+	if pi != nil {
+		if piMetric := pi.collect(); piMetric != nil {
+			metrics.RaspberryPi = piMetric
+			hasAnyMetric = true
+		}
+	}
+
 	if !hasAnyMetric {
 		return nil
 	}
@@ -313,6 +327,13 @@ func (c *Collector) GetTaskMetrics() *TaskMetrics {
 	return metrics
 }
 
+// SetComputeInterval changes how long compute metrics are cached.
+func (c *Collector) SetComputeInterval(seconds int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.computeInterval = time.Duration(seconds) * time.Second
+}
+
 // SetMonitoredProcesses sets the list of process names to monitor
 func (c *Collector) SetMonitoredProcesses(processNames []string) {
 	c.mu.Lock()
@@ -331,6 +352,10 @@ func (c *Collector) collectProcess() *ProcessMetrics {
 		MonitoredProcess: make([]ProcessInfo, 0),
 	}
 
+	c.mu.RLock()
+	monitoredProcessNames := c.monitoredProcessNames
+	c.mu.RUnlock()
+
 	runningCount := 0
 	sleepingCount := 0
 
@@ -357,14 +382,14 @@ func (c *Collector) collectProcess() *ProcessMetrics {
 		}
 
 		// Check if this is a monitored process
-		if len(c.monitoredProcessNames) > 0 {
+		if len(monitoredProcessNames) > 0 {
 			name, err := p.Name()
 			if err != nil {
 				continue
 			}
 
 			// Check if this process name matches any monitored process
-			for _, monitoredName := range c.monitoredProcessNames {
+			for _, monitoredName := range monitoredProcessNames {
 				if strings.Contains(strings.ToLower(name), strings.ToLower(monitoredName)) {
 					info := ProcessInfo{
 						Name:   name,
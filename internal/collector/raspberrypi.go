@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RaspberryPiMetrics are health signals from the Raspberry Pi firmware and
+// sysfs. Under-voltage is worth watching: brown-outs are a common cause of
+// SD card corruption.
+type RaspberryPiMetrics struct {
+	Throttled  *ThrottledState `json:"throttled,omitempty"`
+	ARMFreqMHz float64         `json:"arm_freq_mhz,omitempty"`
+	// ARMFreqMinMHz and ARMFreqMaxMHz are the range cpufreq may choose
+	// from; ARMFreqMHz below the maximum under load means capping.
+	ARMFreqMinMHz float64 `json:"arm_freq_min_mhz,omitempty"`
+	ARMFreqMaxMHz float64 `json:"arm_freq_max_mhz,omitempty"`
+	SoCCelsius    float64 `json:"soc_celsius,omitempty"`
+}
+
+// ThrottledState decodes the firmware's get_throttled bits, as printed by
+// "vcgencmd get_throttled". The Occurred flags are sticky since boot.
+type ThrottledState struct {
+	// Raw is the firmware value in hex, e.g. "0x50005". It is empty when
+	// only the under-voltage alarm could be read.
+	Raw                     string `json:"raw,omitempty"`
+	UnderVoltage            bool   `json:"under_voltage"`
+	FrequencyCapped         bool   `json:"frequency_capped"`
+	Throttled               bool   `json:"throttled"`
+	SoftTempLimit           bool   `json:"soft_temp_limit"`
+	UnderVoltageOccurred    bool   `json:"under_voltage_occurred"`
+	FrequencyCappedOccurred bool   `json:"frequency_capped_occurred"`
+	ThrottledOccurred       bool   `json:"throttled_occurred"`
+	SoftTempLimitOccurred   bool   `json:"soft_temp_limit_occurred"`
+}
+
+// throttledFiles are where the firmware driver exposes get_throttled,
+// usually soc/soc:firmware; the platform device is named differently on
+// some models.
+var throttledFiles = []string{
+	"sys/devices/platform/*firmware/get_throttled",
+	"sys/devices/platform/*/*firmware/get_throttled",
+}
+
+// raspberryPi reads Raspberry Pi health signals from files under root.
+type raspberryPi struct {
+	root string
+}
+
+func (p raspberryPi) path(name string) string {
+	return filepath.Join(p.root, filepath.FromSlash(name))
+}
+
+func (p raspberryPi) read(name string) (string, bool) {
+	data, err := os.ReadFile(p.path(name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+func (p raspberryPi) collect() *RaspberryPiMetrics {
+	metrics := &RaspberryPiMetrics{
+		Throttled:     p.throttled(),
+		ARMFreqMHz:    p.freqMHz("scaling_cur_freq"),
+		ARMFreqMinMHz: p.freqMHz("cpuinfo_min_freq"),
+		ARMFreqMaxMHz: p.freqMHz("cpuinfo_max_freq"),
+		SoCCelsius:    p.socCelsius(),
+	}
+	if *metrics == (RaspberryPiMetrics{}) {
+		return nil
+	}
+	return metrics
+}
+
+func (p raspberryPi) throttled() *ThrottledState {
+	for _, pattern := range throttledFiles {
+		matches, _ := filepath.Glob(p.path(pattern))
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				continue
+			}
+			value, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 32)
+			if err != nil {
+				continue
+			}
+			return decodeThrottled(uint32(value))
+		}
+	}
+
+	// Without the firmware attribute, the rpi_volt hwmon device still
+	// reports current under-voltage.
+	names, _ := filepath.Glob(p.path("sys/class/hwmon/hwmon*/name"))
+	for _, name := range names {
+		if data, err := os.ReadFile(name); err != nil || strings.TrimSpace(string(data)) != "rpi_volt" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(name), "in0_lcrit_alarm"))
+		if err != nil {
+			continue
+		}
+		return &ThrottledState{UnderVoltage: strings.TrimSpace(string(data)) == "1"}
+	}
+	return nil
+}
+
+func decodeThrottled(v uint32) *ThrottledState {
+	return &ThrottledState{
+		Raw:                     "0x" + strconv.FormatUint(uint64(v), 16),
+		UnderVoltage:            v&(1<<0) != 0,
+		FrequencyCapped:         v&(1<<1) != 0,
+		Throttled:               v&(1<<2) != 0,
+		SoftTempLimit:           v&(1<<3) != 0,
+		UnderVoltageOccurred:    v&(1<<16) != 0,
+		FrequencyCappedOccurred: v&(1<<17) != 0,
+		ThrottledOccurred:       v&(1<<18) != 0,
+		SoftTempLimitOccurred:   v&(1<<19) != 0,
+	}
+}
+
+// freqMHz reads a cpufreq value for CPU 0, which cpufreq reports in kHz.
+// All ARM cores on a Pi share one clock.
+func (p raspberryPi) freqMHz(name string) float64 {
+	s, ok := p.read("sys/devices/system/cpu/cpu0/cpufreq/" + name)
+	if !ok {
+		return 0
+	}
+	khz, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return khz / 1000
+}
+
+// socCelsius reads the cpu-thermal zone, which is the SoC sensor on every
+// Pi, falling back to the first zone.
+func (p raspberryPi) socCelsius() float64 {
+	types, _ := filepath.Glob(p.path("sys/class/thermal/thermal_zone*/type"))
+	zone := p.path("sys/class/thermal/thermal_zone0")
+	for _, t := range types {
+		if data, err := os.ReadFile(t); err == nil && strings.TrimSpace(string(data)) == "cpu-thermal" {
+			zone = filepath.Dir(t)
+			break
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(zone, "temp"))
+	if err != nil {
+		return 0
+	}
+	millis, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0
+	}
+	return millis / 1000
+}
+
+// EnableRaspberryPi adds Raspberry Pi health signals to compute metrics.
+func (c *Collector) EnableRaspberryPi() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.raspberryPi = &raspberryPi{root: "/"}
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/binary-gws/agent/internal/testutil"
+)
+
+func TestRaspberryPiMetrics(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{
+		"sys/devices/platform/soc/soc:firmware/get_throttled":  "50005\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq": "600000\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_min_freq": "600000\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq": "1800000\n",
+		"sys/class/thermal/thermal_zone0/type":                 "gpu-thermal\n",
+		"sys/class/thermal/thermal_zone0/temp":                 "40000\n",
+		"sys/class/thermal/thermal_zone1/type":                 "cpu-thermal\n",
+		"sys/class/thermal/thermal_zone1/temp":                 "61835\n",
+	})
+
+	m := raspberryPi{root: root}.collect()
+	if m == nil {
+		t.Fatal("expected metrics")
+	}
+	want := ThrottledState{
+		Raw:                  "0x50005",
+		UnderVoltage:         true,
+		Throttled:            true,
+		UnderVoltageOccurred: true,
+		ThrottledOccurred:    true,
+	}
+	if m.Throttled == nil || *m.Throttled != want {
+		t.Errorf("expected %+v, got %+v", want, m.Throttled)
+	}
+	if m.ARMFreqMHz != 600 || m.ARMFreqMinMHz != 600 || m.ARMFreqMaxMHz != 1800 {
+		t.Errorf("expected 600 MHz of 600-1800, got %v of %v-%v", m.ARMFreqMHz, m.ARMFreqMinMHz, m.ARMFreqMaxMHz)
+	}
+	if m.SoCCelsius != 61.835 {
+		t.Errorf("expected the cpu-thermal zone at 61.835, got %v", m.SoCCelsius)
+	}
+}
+
+func TestRaspberryPiUnderVoltageAlarm(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{
+		"sys/class/hwmon/hwmon0/name":            "cpu_thermal\n",
+		"sys/class/hwmon/hwmon1/name":            "rpi_volt\n",
+		"sys/class/hwmon/hwmon1/in0_lcrit_alarm": "1\n",
+		"sys/class/thermal/thermal_zone0/temp":   "48312\n",
+	})
+
+	m := raspberryPi{root: root}.collect()
+	if m == nil || m.Throttled == nil {
+		t.Fatalf("expected throttled state from rpi_volt, got %+v", m)
+	}
+	if *m.Throttled != (ThrottledState{UnderVoltage: true}) {
+		t.Errorf("expected only current under-voltage, got %+v", m.Throttled)
+	}
+	if m.SoCCelsius != 48.312 {
+		t.Errorf("expected thermal_zone0 as fallback, got %v", m.SoCCelsius)
+	}
+}
+
+func TestRaspberryPiNothingReadable(t *testing.T) {
+	if m := (raspberryPi{root: t.TempDir()}).collect(); m != nil {
+		t.Errorf("expected nil without any sources, got %+v", m)
+	}
+}
+
+func TestDecodeThrottled(t *testing.T) {
+	s := decodeThrottled(0xe000a)
+	if s.Raw != "0xe000a" || s.UnderVoltage || !s.FrequencyCapped || s.Throttled || !s.SoftTempLimit {
+		t.Errorf("unexpected current flags %+v", s)
+	}
+	if s.UnderVoltageOccurred || !s.FrequencyCappedOccurred || !s.ThrottledOccurred || !s.SoftTempLimitOccurred {
+		t.Errorf("unexpected sticky flags %+v", s)
+	}
+}
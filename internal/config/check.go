@@ -0,0 +1,335 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// requestTimeoutSeconds mirrors the transport's default per-request
+// timeout, which a heartbeat interval should not undercut.
+const requestTimeoutSeconds = 10
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a finding of Check. Line and Column are zero when the value
+// did not come from a file position, e.g. a GW_AGENT_* variable or a
+// missing field.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.File, d.Severity, d.Message)
+}
+
+type CheckOptions struct {
+	// SkipSecrets skips reading tokens from files, variables and commands,
+	// e.g. when validating on a machine other than the gateway.
+	SkipSecrets bool
+}
+
+// Check validates the config file and its drop-ins strictly: unknown keys
+// and mistyped values are errors, and questionable but valid settings are
+// reported as warnings.
+func Check(path string, opts CheckOptions) []Diagnostic {
+	var diags []Diagnostic
+	errorAt := func(file string, line, column int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{File: file, Line: line, Column: column, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+
+	files, err := Files(path)
+	if err != nil {
+		errorAt(path, 0, 0, "failed to list drop-in files: %v", err)
+		return diags
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errorAt(file, 0, 0, "%v", err)
+			continue
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			line, msg := yamlErrorLine(err)
+			errorAt(file, line, 1, "%s", msg)
+			continue
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if err := expandNode(root, os.LookupEnv); err != nil {
+			var ne *nodeError
+			if errors.As(err, &ne) {
+				errorAt(file, ne.line, ne.column, "%v", ne.err)
+			} else {
+				errorAt(file, 0, 0, "%v", err)
+			}
+			continue
+		}
+		for _, d := range checkNode(root, reflect.TypeOf(Config{}), "") {
+			errorAt(file, d.Line, d.Column, "%s", d.Message)
+		}
+	}
+	if len(diags) > 0 {
+		return diags
+	}
+
+	cfg, err := Parse(path)
+	if err != nil {
+		errorAt(path, 0, 0, "%v", err)
+		return diags
+	}
+	if err := cfg.applyEnrollment(); err != nil {
+		errorAt(path, 0, 0, "%v", err)
+	}
+
+	at := func(severity, path, message string) {
+		d := Diagnostic{File: files[0], Severity: severity, Message: message}
+		if o, ok := cfg.origins[path]; ok {
+			d.File, d.Line, d.Column = o.source, o.line, o.column
+		}
+		diags = append(diags, d)
+	}
+
+	problems := cfg.validate()
+	for _, p := range problems {
+		at(SeverityError, p.path, p.message)
+	}
+	if len(problems) > 0 {
+		return diags
+	}
+
+	if !opts.SkipSecrets {
+		for _, src := range []struct {
+			path   string
+			source func() error
+		}{
+			{"auth.token_current", func() error { _, err := cfg.Auth.CurrentSource().Resolve(context.Background()); return err }},
+			{"auth.token_grace", func() error { _, err := cfg.Auth.GraceSource().Resolve(context.Background()); return err }},
+		} {
+			if err := src.source(); err != nil {
+				at(SeverityError, cfg.sourcePath(src.path), err.Error())
+			}
+		}
+	}
+
+	cfg.setDefaults()
+	for _, p := range cfg.lint() {
+		at(SeverityWarning, p.path, p.message)
+	}
+	return diags
+}
+
+// sourcePath returns the path of whichever key sets the token at path,
+// e.g. auth.token_current_file for auth.token_current.
+func (c *Config) sourcePath(path string) string {
+	for _, suffix := range []string{"", "_file", "_env", "_command"} {
+		if _, ok := c.origins[path+suffix]; ok {
+			return path + suffix
+		}
+	}
+	return path
+}
+
+// lint reports settings that are valid but probably not what was meant.
+// It expects defaults to have been applied.
+func (c *Config) lint() []problem {
+	var defaults Config
+	defaults.setDefaults()
+
+	var problems []problem
+	add := func(path, message string) {
+		problems = append(problems, problem{path: path, message: message})
+	}
+
+	if c.Intervals.HeartbeatSeconds < requestTimeoutSeconds {
+		add("intervals.heartbeat_seconds", fmt.Sprintf("intervals.heartbeat_seconds (%d) is shorter than the %ds request timeout; a slow request delays the next heartbeat", c.Intervals.HeartbeatSeconds, requestTimeoutSeconds))
+	}
+	if c.Intervals.ComputeSeconds < c.Intervals.HeartbeatSeconds {
+		add("intervals.compute_seconds", fmt.Sprintf("intervals.compute_seconds (%d) is shorter than intervals.heartbeat_seconds (%d); metrics are only collected once per heartbeat", c.Intervals.ComputeSeconds, c.Intervals.HeartbeatSeconds))
+	}
+	if c.TLS.InsecureSkipVerify {
+		add("tls.insecure_skip_verify", "tls.insecure_skip_verify disables certificate verification")
+	}
+	for i, u := range append([]string{c.APIURL}, c.APIURLFallbacks...) {
+		if strings.HasPrefix(strings.ToLower(u), "http://") {
+			path := "api_url"
+			if i > 0 {
+				path = "api_url_fallbacks"
+			}
+			add(path, fmt.Sprintf("%s sends tokens over plain HTTP", u))
+		}
+	}
+	if c.Payload.Mode != "delta" && c.Payload.FullSnapshotEvery != defaults.Payload.FullSnapshotEvery {
+		add("payload.full_snapshot_every", "payload.full_snapshot_every has no effect unless payload.mode is delta")
+	}
+	if c.hasOrigin("auth.refresh_seconds") && !c.Auth.CurrentSource().External() && !c.Auth.GraceSource().External() {
+		add("auth.refresh_seconds", "auth.refresh_seconds has no effect without a token file, env or command source")
+	}
+	if c.Compression.MinBytes != defaults.Compression.MinBytes && normalizedCompression(c.Compression.Algorithm) == "" {
+		add("compression.min_bytes", "compression.min_bytes has no effect without compression.algorithm")
+	}
+	return problems
+}
+
+func (c *Config) hasOrigin(path string) bool {
+	_, ok := c.origins[path]
+	return ok
+}
+
+func normalizedCompression(algorithm string) string {
+	switch strings.ToLower(algorithm) {
+	case "gzip", "zstd":
+		return strings.ToLower(algorithm)
+	default:
+		return ""
+	}
+}
+
+// checkNode compares a YAML node with the Go type it decodes into and
+// reports unknown keys and values of the wrong kind.
+func checkNode(node *yaml.Node, t reflect.Type, path string) []Diagnostic {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+		return nil
+	}
+	wrong := func(want string) []Diagnostic {
+		return []Diagnostic{{Line: node.Line, Column: node.Column, Message: fmt.Sprintf("%s must be %s", displayPath(path), want)}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return wrong("a mapping")
+		}
+		var diags []Diagnostic
+		known := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := known[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %q", joinPath(path, key.Value))
+				if suggestion := closest(key.Value, known); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				diags = append(diags, Diagnostic{Line: key.Line, Column: key.Column, Message: msg})
+				continue
+			}
+			diags = append(diags, checkNode(value, field, joinPath(path, key.Value))...)
+		}
+		return diags
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			return wrong("a string")
+		}
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			return wrong("an integer")
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			return wrong("true or false")
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return wrong("a list")
+		}
+		var diags []Diagnostic
+		for i, item := range node.Content {
+			diags = append(diags, checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return diags
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return wrong("a mapping")
+		}
+		var diags []Diagnostic
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			diags = append(diags, checkNode(node.Content[i+1], t.Elem(), fmt.Sprintf("%s[%s]", path, node.Content[i].Value))...)
+		}
+		return diags
+	}
+	return nil
+}
+
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if tag != "" && tag != "-" {
+			fields[tag] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "the document"
+	}
+	return path
+}
+
+// closest returns the known key nearest to key by edit distance, if it is
+// close enough to be a likely typo.
+func closest(key string, known map[string]reflect.Type) string {
+	best, bestDist := "", 4
+	for candidate := range known {
+		if d := editDistance(key, candidate); d < bestDist || (d == bestDist && candidate < best) {
+			best, bestDist = candidate, d
+		}
+	}
+	if bestDist > len(key)/2 {
+		return ""
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+var yamlLineRE = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// yamlErrorLine extracts the line number from a yaml.v3 syntax error.
+func yamlErrorLine(err error) (int, string) {
+	if m := yamlLineRE.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line, m[2]
+	}
+	return 0, err.Error()
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const checkBase = `uuid: test-gateway-123
+client_id: test-client
+site_id: test-site
+api_url: https://api.example.com/heartbeat
+auth:
+  token_current: secret-token
+intervals:
+  heartbeat_seconds: 30
+  compute_seconds: 60
+`
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		dropIn  string
+		want    []string
+		wantLen int
+	}{
+		{
+			name:    "clean",
+			config:  checkBase,
+			wantLen: 0,
+		},
+		{
+			name:    "unknown key with suggestion",
+			config:  checkBase + "intervals_x: 1\ncompresion:\n  algorithm: gzip\n",
+			want:    []string{`config.yaml:10:1: error: unknown key "intervals_x"`, `config.yaml:11:1: error: unknown key "compresion" (did you mean "compression"?)`},
+			wantLen: 2,
+		},
+		{
+			name:    "nested unknown key",
+			config:  checkBase + "tls:\n  insecure_skip_verfy: true\n",
+			want:    []string{`config.yaml:11:3: error: unknown key "tls.insecure_skip_verfy" (did you mean "insecure_skip_verify"?)`},
+			wantLen: 1,
+		},
+		{
+			name:    "wrong types",
+			config:  strings.Replace(checkBase, "heartbeat_seconds: 30", "heartbeat_seconds: soon", 1) + "monitoring:\n  processes: nginx\n",
+			want:    []string{`config.yaml:8:22: error: intervals.heartbeat_seconds must be an integer`, `config.yaml:11:14: error: monitoring.processes must be a list`},
+			wantLen: 2,
+		},
+		{
+			name:    "syntax error",
+			config:  checkBase + "site: a: b\n",
+			want:    []string{"config.yaml:10:1: error: mapping values are not allowed"},
+			wantLen: 1,
+		},
+		{
+			name:    "validation error positioned in drop-in",
+			config:  checkBase,
+			dropIn:  "payload:\n  mode: partial\n",
+			want:    []string{`10-payload.yaml:2:9: error: payload.mode must be full or delta`},
+			wantLen: 1,
+		},
+		{
+			name:   "warnings",
+			config: strings.Replace(checkBase, "https://api", "http://api", 1) + "tls:\n  insecure_skip_verify: true\ncompression:\n  min_bytes: 512\n",
+			want: []string{
+				`config.yaml:4:10: warning: http://api.example.com/heartbeat sends tokens over plain HTTP`,
+				`config.yaml:11:25: warning: tls.insecure_skip_verify disables certificate verification`,
+				`config.yaml:13:14: warning: compression.min_bytes has no effect without compression.algorithm`,
+			},
+			wantLen: 3,
+		},
+		{
+			name:    "missing token file",
+			config:  strings.Replace(checkBase, "token_current: secret-token", "token_current_file: /nonexistent/token", 1),
+			want:    []string{`config.yaml:6:23: error:`},
+			wantLen: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+			writeFile(t, configPath, tt.config+"data_dir: "+tmpDir+"\n")
+			if tt.dropIn != "" {
+				writeFile(t, filepath.Join(tmpDir, DropInDirName, "10-payload.yaml"), tt.dropIn)
+			}
+
+			diags := Check(configPath, CheckOptions{})
+			var lines []string
+			for _, d := range diags {
+				lines = append(lines, strings.TrimPrefix(d.String(), tmpDir+string(filepath.Separator)))
+			}
+			if len(diags) != tt.wantLen {
+				t.Fatalf("got %d diagnostics, want %d:\n%s", len(diags), tt.wantLen, strings.Join(lines, "\n"))
+			}
+			for _, want := range tt.want {
+				found := false
+				for _, line := range lines {
+					if strings.HasPrefix(strings.TrimPrefix(line, DropInDirName+string(filepath.Separator)), want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("missing diagnostic %q in:\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSkipSecrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configPath, strings.Replace(checkBase, "token_current: secret-token", "token_current_file: /nonexistent/token", 1)+"data_dir: "+tmpDir+"\n")
+
+	if diags := Check(configPath, CheckOptions{SkipSecrets: true}); len(diags) != 0 {
+		t.Errorf("expected no diagnostics with SkipSecrets, got %v", diags)
+	}
+}
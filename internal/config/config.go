@@ -1,30 +1,102 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
+	"github.com/binary-gws/agent/internal/enrollment"
+	"github.com/binary-gws/agent/internal/logging"
+	"github.com/binary-gws/agent/internal/remoteconfig"
+	"github.com/binary-gws/agent/internal/secrets"
+	"github.com/binary-gws/agent/internal/transport"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	UUID            string    `yaml:"uuid"`
-	ClientID        string    `yaml:"client_id"`
-	SiteID          string    `yaml:"site_id"`
-	APIURL          string    `yaml:"api_url"`
-	APIURLFallbacks []string  `yaml:"api_url_fallbacks"`
-	Auth            Auth      `yaml:"auth"`
-	Platform        Platform  `yaml:"platform"`
-	Intervals       Intervals `yaml:"intervals"`
-	TLS             TLS       `yaml:"tls"`
+	UUID            string       `yaml:"uuid"`
+	ClientID        string       `yaml:"client_id"`
+	SiteID          string       `yaml:"site_id"`
+	APIURL          string       `yaml:"api_url"`
+	APIURLFallbacks []string     `yaml:"api_url_fallbacks"`
+	Auth            Auth         `yaml:"auth"`
+	Platform        Platform     `yaml:"platform"`
+	Intervals       Intervals    `yaml:"intervals"`
+	TLS             TLS          `yaml:"tls"`
+	Compression     Compression  `yaml:"compression"`
+	Payload         Payload      `yaml:"payload"`
+	DataDir         string       `yaml:"data_dir"`
+	Enrollment      Enrollment   `yaml:"enrollment"`
+	Logging         Logging      `yaml:"logging"`
+	Monitoring      Monitoring   `yaml:"monitoring"`
+	RemoteConfig    RemoteConfig `yaml:"remote_config"`
+
+	// origins maps a dotted YAML path to where its value was set.
+	origins map[string]origin
 }
 
+// Auth tokens are given literally or read from a file, an environment
+// variable or the stdout of a command. At most one source may be set per
+// token.
 type Auth struct {
-	TokenCurrent string `yaml:"token_current"`
-	TokenGrace   string `yaml:"token_grace"`
+	TokenCurrent        string   `yaml:"token_current"`
+	TokenCurrentFile    string   `yaml:"token_current_file"`
+	TokenCurrentEnv     string   `yaml:"token_current_env"`
+	TokenCurrentCommand []string `yaml:"token_current_command"`
+	TokenGrace          string   `yaml:"token_grace"`
+	TokenGraceFile      string   `yaml:"token_grace_file"`
+	TokenGraceEnv       string   `yaml:"token_grace_env"`
+	TokenGraceCommand   []string `yaml:"token_grace_command"`
+	// RefreshSeconds is how often external token sources are re-read.
+	RefreshSeconds int `yaml:"refresh_seconds"`
+}
+
+func (a Auth) CurrentSource() secrets.Source {
+	return secrets.Source{
+		Name:    "auth.token_current",
+		Value:   a.TokenCurrent,
+		File:    a.TokenCurrentFile,
+		Env:     a.TokenCurrentEnv,
+		Command: a.TokenCurrentCommand,
+	}
+}
+
+func (a Auth) GraceSource() secrets.Source {
+	return secrets.Source{
+		Name:    "auth.token_grace",
+		Value:   a.TokenGrace,
+		File:    a.TokenGraceFile,
+		Env:     a.TokenGraceEnv,
+		Command: a.TokenGraceCommand,
+	}
+}
+
+// Redacted returns a copy of the config that is safe to print.
+func (c *Config) Redacted() *Config {
+	out := *c
+	if out.Auth.TokenCurrent != "" {
+		out.Auth.TokenCurrent = "[REDACTED]"
+	}
+	if out.Auth.TokenGrace != "" {
+		out.Auth.TokenGrace = "[REDACTED]"
+	}
+	return &out
+}
+
+// Secrets returns every secret value resolved from the config.
+func (c *Config) Secrets() []string {
+	var values []string
+	for _, v := range []string{c.Auth.TokenCurrent, c.Auth.TokenGrace} {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 type Platform struct {
@@ -36,47 +108,293 @@ type Intervals struct {
 	ComputeSeconds   int `yaml:"compute_seconds"`
 }
 
+type Compression struct {
+	Algorithm string `yaml:"algorithm"`
+	// MinBytes of 0 means the default of 1024; the smallest threshold is 1,
+	// which compresses every body.
+	MinBytes int `yaml:"min_bytes"`
+}
+
+type Enrollment struct {
+	URL string `yaml:"url"`
+}
+
+type Logging struct {
+	Level string `yaml:"level"`
+	// Format is json or text; text is meant for reading on a console.
+	Format string  `yaml:"format"`
+	File   LogFile `yaml:"file"`
+	// Journald sends entries to journald with their priority and fields.
+	Journald  bool         `yaml:"journald"`
+	Syslog    Syslog       `yaml:"syslog"`
+	Heartbeat LogHeartbeat `yaml:"heartbeat"`
+	RateLimit LogRateLimit `yaml:"rate_limit"`
+}
+
+// LogRateLimit collapses similar entries per level; see RateLimit.
+type LogRateLimit struct {
+	Disabled bool      `yaml:"disabled"`
+	Debug    RateLimit `yaml:"debug"`
+	Info     RateLimit `yaml:"info"`
+	Warn     RateLimit `yaml:"warn"`
+	Error    RateLimit `yaml:"error"`
+}
+
+// RateLimit logs the first Burst similar entries in each WindowSeconds and
+// summarises the rest in one line when the window ends.
+type RateLimit struct {
+	WindowSeconds int `yaml:"window_seconds"`
+	Burst         int `yaml:"burst"`
+}
+
+// LogHeartbeat keeps the last MaxEntries distinct warnings and errors and
+// sends new ones with each heartbeat, up to MaxBytes of them.
+type LogHeartbeat struct {
+	MaxEntries int `yaml:"max_entries"`
+	MaxBytes   int `yaml:"max_bytes"`
+}
+
+// LogFile writes logs to Path in addition to stdout. The file is rotated
+// when it exceeds MaxSizeMB or is MaxAgeHours old, and the newest MaxFiles
+// rotated files are kept. A limit of 0 takes the default and -1 disables
+// it.
+type LogFile struct {
+	Path        string `yaml:"path"`
+	MaxSizeMB   int    `yaml:"max_size_mb"`
+	MaxAgeHours int    `yaml:"max_age_hours"`
+	MaxFiles    int    `yaml:"max_files"`
+	// Compress is gzip (default) or none for rotated files.
+	Compress string `yaml:"compress"`
+}
+
+// Syslog sends RFC 5424 messages to a relay at Address when it is set.
+type Syslog struct {
+	// Network is udp (default), tcp or unix.
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	Facility string `yaml:"facility"`
+	Tag      string `yaml:"tag"`
+}
+
+type Monitoring struct {
+	// Processes are name substrings of processes to report individually.
+	Processes []string `yaml:"processes"`
+}
+
+// RemoteConfig enables config overlays fetched from the backend. Bundles
+// must be signed by PublicKey (base64 Ed25519).
+type RemoteConfig struct {
+	URL         string `yaml:"url"`
+	PublicKey   string `yaml:"public_key"`
+	PollSeconds int    `yaml:"poll_seconds"`
+	// RollbackAfterFailures is how many consecutive failed heartbeats after
+	// applying an overlay roll it back.
+	RollbackAfterFailures int `yaml:"rollback_after_failures"`
+}
+
+type Payload struct {
+	Mode              string `yaml:"mode"`
+	FullSnapshotEvery int    `yaml:"full_snapshot_every"`
+}
+
 type TLS struct {
-	CABundlePath       string `yaml:"ca_bundle_path"`
-	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CABundlePath       string              `yaml:"ca_bundle_path"`
+	InsecureSkipVerify bool                `yaml:"insecure_skip_verify"`
+	SPKIPins           map[string][]string `yaml:"spki_pins"`
 }
 
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	return load(path, nil)
+}
+
+// LoadWithOverlay loads the config as if overlay were the active remote
+// config overlay. It is used to validate a bundle before it is stored.
+func LoadWithOverlay(path string, overlay *remoteconfig.Bundle) (*Config, error) {
+	return load(path, overlay)
+}
+
+func load(path string, overlay *remoteconfig.Bundle) (*Config, error) {
+	cfg, err := parse(path, overlay)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if err := cfg.applyEnrollment(); err != nil {
+		return nil, err
 	}
 
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
 	cfg.setDefaults()
+	return cfg, nil
+}
+
+// Parse reads the config file merged with its conf.d drop-ins, expanding
+// ${VAR} references and applying GW_AGENT_* overrides, without enrollment
+// state, validation or defaults. It is used by commands that run before the
+// agent is enrolled.
+func Parse(path string) (*Config, error) {
+	return parse(path, nil)
+}
+
+// parse merges the config files and, when remote config is enabled, the
+// remote overlay: overlay if given, otherwise the active one in data_dir.
+// The overlay sits between the files and GW_AGENT_* variables.
+func parse(path string, overlay *remoteconfig.Bundle) (*Config, error) {
+	origins := make(map[string]origin)
+	merged, err := readMerged(path, os.LookupEnv, origins)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decode(merged, origins)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RemoteConfig.URL == "" {
+		return cfg, nil
+	}
+
+	if overlay == nil {
+		if overlay, err = remoteconfig.Active(cfg.StateDir()); err != nil {
+			return nil, err
+		}
+	}
+	if overlay == nil {
+		return cfg, nil
+	}
+	node, err := parseOverlay([]byte(overlay.Config))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", overlay.Label(), err)
+	}
+	if node == nil {
+		return cfg, nil
+	}
+	merged = mergeNode(merged, node, overlay.Label(), "", origins)
+	return decode(merged, origins)
+}
+
+func decode(merged *yaml.Node, origins map[string]origin) (*Config, error) {
+	cfg := Config{origins: origins}
+	if merged != nil {
+		if err := merged.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	if err := applyEnvOverrides(&cfg, os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("failed to apply environment overrides: %w", err)
+	}
 	return &cfg, nil
 }
 
+// StateDir returns data_dir, or the platform default when it is unset.
+func (c *Config) StateDir() string {
+	if c.DataDir != "" {
+		return c.DataDir
+	}
+	return defaultDataDir()
+}
+
+// applyEnrollment fills identity and token fields left empty in the config
+// from the state written by the enroll command. Values set in the config
+// file always win, and the state is not read when nothing is missing.
+func (c *Config) applyEnrollment() error {
+	missingToken := c.Auth.CurrentSource().Count() == 0
+	if c.UUID != "" && c.ClientID != "" && c.SiteID != "" && !missingToken {
+		return nil
+	}
+	state, err := enrollment.Load(c.StateDir())
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+	origin := filepath.Join(c.StateDir(), enrollment.FileName)
+	fill := func(field *string, path, value string) {
+		if *field == "" && value != "" {
+			*field = value
+			c.setOrigin(path, origin)
+		}
+	}
+	fill(&c.UUID, "uuid", state.UUID)
+	fill(&c.ClientID, "client_id", state.ClientID)
+	fill(&c.SiteID, "site_id", state.SiteID)
+	if missingToken {
+		fill(&c.Auth.TokenCurrent, "auth.token_current", state.Token)
+	}
+	return nil
+}
+
+func (c *Config) setOrigin(path, source string) {
+	if c.origins == nil {
+		c.origins = make(map[string]origin)
+	}
+	clearOrigins(c.origins, path)
+	c.origins[path] = origin{source: source}
+}
+
+// resolveSecrets reads tokens from their external sources into TokenCurrent
+// and TokenGrace.
+func (c *Config) resolveSecrets() error {
+	ctx := context.Background()
+	current, err := c.Auth.CurrentSource().Resolve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve token: %w", err)
+	}
+	grace, err := c.Auth.GraceSource().Resolve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve token: %w", err)
+	}
+	c.Auth.TokenCurrent = current
+	c.Auth.TokenGrace = grace
+	return nil
+}
+
 func (c *Config) Validate() error {
-	var errs []string
+	problems := c.validate()
+	if len(problems) == 0 {
+		return nil
+	}
+	errs := make([]string, len(problems))
+	for i, p := range problems {
+		errs[i] = p.message
+	}
+	return errors.New("config validation failed: " + joinErrors(errs))
+}
+
+// problem is a validation finding tied to the YAML path it is about, so
+// the validate command can point at the line that set it.
+type problem struct {
+	path    string
+	message string
+}
+
+func (c *Config) validate() []problem {
+	var problems []problem
+	add := func(path, message string) {
+		problems = append(problems, problem{path: path, message: message})
+	}
 
 	if c.UUID == "" {
-		errs = append(errs, "uuid is required")
+		add("uuid", "uuid is required")
 	}
 	if c.ClientID == "" {
-		errs = append(errs, "client_id is required")
+		add("client_id", "client_id is required")
 	}
 	if c.SiteID == "" {
-		errs = append(errs, "site_id is required")
+		add("site_id", "site_id is required")
 	}
 	if c.APIURL == "" {
-		errs = append(errs, "api_url is required")
+		add("api_url", "api_url is required")
 	} else {
 		if err := validateHTTPURL(c.APIURL, "api_url"); err != nil {
-			errs = append(errs, err.Error())
+			add("api_url", err.Error())
 		}
 	}
 	for i, fallback := range c.APIURLFallbacks {
@@ -85,28 +403,162 @@ func (c *Config) Validate() error {
 		}
 		label := fmt.Sprintf("api_url_fallbacks[%d]", i)
 		if err := validateHTTPURL(fallback, label); err != nil {
-			errs = append(errs, err.Error())
+			add("api_url_fallbacks", err.Error())
 		}
 	}
-	if c.Auth.TokenCurrent == "" {
-		errs = append(errs, "auth.token_current is required")
+	currentSources := c.Auth.CurrentSource().Count()
+	if currentSources == 0 {
+		add("auth.token_current", "auth.token_current is required")
+	}
+	if currentSources > 1 {
+		add("auth", "only one of auth.token_current, token_current_file, token_current_env, token_current_command may be set")
+	}
+	if c.Auth.GraceSource().Count() > 1 {
+		add("auth", "only one of auth.token_grace, token_grace_file, token_grace_env, token_grace_command may be set")
+	}
+	if c.Auth.RefreshSeconds < 0 {
+		add("auth.refresh_seconds", "auth.refresh_seconds cannot be negative")
+	}
+	if c.UUID == "" || currentSources == 0 {
+		add("", "run 'gw-agent enroll' or set the missing fields in the config file")
+	}
+	if c.Enrollment.URL != "" {
+		if err := validateHTTPURL(c.Enrollment.URL, "enrollment.url"); err != nil {
+			add("enrollment.url", err.Error())
+		}
 	}
 
 	if c.Intervals.HeartbeatSeconds < 0 {
-		errs = append(errs, "intervals.heartbeat_seconds cannot be negative")
+		add("intervals.heartbeat_seconds", "intervals.heartbeat_seconds cannot be negative")
 	}
 	if c.Intervals.ComputeSeconds < 0 {
-		errs = append(errs, "intervals.compute_seconds cannot be negative")
+		add("intervals.compute_seconds", "intervals.compute_seconds cannot be negative")
 	}
 
-	if c.TLS.InsecureSkipVerify && c.TLS.CABundlePath != "" {
-		errs = append(errs, "tls.insecure_skip_verify and tls.ca_bundle_path are mutually exclusive")
+	switch strings.ToLower(c.Compression.Algorithm) {
+	case "", "none", "identity", "gzip", "zstd":
+	default:
+		add("compression.algorithm", "compression.algorithm must be one of none, gzip, zstd")
+	}
+	if c.Compression.MinBytes < 0 {
+		add("compression.min_bytes", "compression.min_bytes cannot be negative")
 	}
 
-	if len(errs) > 0 {
-		return errors.New("config validation failed: " + joinErrors(errs))
+	switch strings.ToLower(c.Logging.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		add("logging.level", "logging.level must be one of debug, info, warn, error")
 	}
-	return nil
+	if _, err := logging.ParseFormat(c.Logging.Format); err != nil {
+		add("logging.format", "logging.format must be json or text")
+	}
+
+	if c.Logging.File.MaxSizeMB < -1 {
+		add("logging.file.max_size_mb", "logging.file.max_size_mb must be -1 (no limit) or more")
+	}
+	if c.Logging.File.MaxAgeHours < -1 {
+		add("logging.file.max_age_hours", "logging.file.max_age_hours must be -1 (no limit) or more")
+	}
+	if c.Logging.File.MaxFiles < -1 {
+		add("logging.file.max_files", "logging.file.max_files must be -1 (no limit) or more")
+	}
+	switch strings.ToLower(c.Logging.File.Compress) {
+	case "", "gzip", "none":
+	default:
+		add("logging.file.compress", "logging.file.compress must be gzip or none")
+	}
+
+	if c.Logging.Heartbeat.MaxEntries < 0 {
+		add("logging.heartbeat.max_entries", "logging.heartbeat.max_entries cannot be negative")
+	}
+	if c.Logging.Heartbeat.MaxBytes < 0 {
+		add("logging.heartbeat.max_bytes", "logging.heartbeat.max_bytes cannot be negative")
+	}
+
+	for _, l := range []struct {
+		name  string
+		limit RateLimit
+	}{
+		{"debug", c.Logging.RateLimit.Debug},
+		{"info", c.Logging.RateLimit.Info},
+		{"warn", c.Logging.RateLimit.Warn},
+		{"error", c.Logging.RateLimit.Error},
+	} {
+		if l.limit.WindowSeconds < 0 {
+			add("logging.rate_limit."+l.name+".window_seconds", "logging.rate_limit."+l.name+".window_seconds cannot be negative")
+		}
+		if l.limit.Burst < 0 {
+			add("logging.rate_limit."+l.name+".burst", "logging.rate_limit."+l.name+".burst cannot be negative")
+		}
+	}
+
+	switch c.Logging.Syslog.Network {
+	case "", "udp", "tcp", "unix":
+	default:
+		add("logging.syslog.network", "logging.syslog.network must be udp, tcp or unix")
+	}
+	if c.Logging.Syslog.Network != "" && c.Logging.Syslog.Address == "" {
+		add("logging.syslog.address", "logging.syslog.address is required with logging.syslog.network")
+	}
+	if c.Logging.Syslog.Facility != "" {
+		if _, err := logging.ParseFacility(c.Logging.Syslog.Facility); err != nil {
+			add("logging.syslog.facility", "logging.syslog.facility: "+err.Error())
+		}
+	}
+
+	switch c.Payload.Mode {
+	case "", "full", "delta":
+	default:
+		add("payload.mode", "payload.mode must be full or delta")
+	}
+	if c.Payload.FullSnapshotEvery < 0 {
+		add("payload.full_snapshot_every", "payload.full_snapshot_every cannot be negative")
+	}
+
+	if c.RemoteConfig.URL != "" {
+		if err := validateHTTPURL(c.RemoteConfig.URL, "remote_config.url"); err != nil {
+			add("remote_config.url", err.Error())
+		}
+		if c.RemoteConfig.PublicKey == "" {
+			add("remote_config.public_key", "remote_config.public_key is required with remote_config.url")
+		}
+	}
+	if c.RemoteConfig.PublicKey != "" {
+		if _, err := remoteconfig.ParsePublicKey(c.RemoteConfig.PublicKey); err != nil {
+			add("remote_config.public_key", "remote_config.public_key: "+err.Error())
+		}
+	}
+	if c.RemoteConfig.PollSeconds < 0 {
+		add("remote_config.poll_seconds", "remote_config.poll_seconds cannot be negative")
+	}
+	if c.RemoteConfig.RollbackAfterFailures < 0 {
+		add("remote_config.rollback_after_failures", "remote_config.rollback_after_failures cannot be negative")
+	}
+
+	if c.TLS.InsecureSkipVerify && c.TLS.CABundlePath != "" {
+		add("tls.insecure_skip_verify", "tls.insecure_skip_verify and tls.ca_bundle_path are mutually exclusive")
+	}
+	for pinnedURL, pins := range c.TLS.SPKIPins {
+		label := fmt.Sprintf("tls.spki_pins[%s]", pinnedURL)
+		path := "tls.spki_pins." + pinnedURL
+		if !c.hasAPIURL(pinnedURL) {
+			add(path, label+" does not match api_url or api_url_fallbacks")
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(pinnedURL), "https://") {
+			add(path, label+" requires an HTTPS URL")
+		}
+		if len(pins) == 0 {
+			add(path, label+" must list at least one pin")
+		}
+		for _, pin := range pins {
+			if _, err := transport.ParsePin(pin); err != nil {
+				add(path, fmt.Sprintf("%s: %v", label, err))
+			}
+		}
+	}
+
+	return problems
 }
 
 func (c *Config) setDefaults() {
@@ -116,6 +568,90 @@ func (c *Config) setDefaults() {
 	if c.Intervals.ComputeSeconds == 0 {
 		c.Intervals.ComputeSeconds = 120
 	}
+	if c.Compression.MinBytes == 0 {
+		c.Compression.MinBytes = 1024
+	}
+	if c.Auth.RefreshSeconds == 0 {
+		c.Auth.RefreshSeconds = 60
+	}
+	c.DataDir = c.StateDir()
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
+	if c.Logging.Format == "" {
+		c.Logging.Format = "json"
+	}
+	if c.Logging.File.MaxSizeMB == 0 {
+		c.Logging.File.MaxSizeMB = 10
+	}
+	if c.Logging.File.MaxAgeHours == 0 {
+		c.Logging.File.MaxAgeHours = 24
+	}
+	if c.Logging.File.MaxFiles == 0 {
+		c.Logging.File.MaxFiles = 7
+	}
+	if c.Logging.File.Compress == "" {
+		c.Logging.File.Compress = "gzip"
+	}
+	if c.Logging.Syslog.Network == "" {
+		c.Logging.Syslog.Network = "udp"
+	}
+	if c.Logging.Syslog.Facility == "" {
+		c.Logging.Syslog.Facility = "daemon"
+	}
+	if c.Logging.Syslog.Tag == "" {
+		c.Logging.Syslog.Tag = "gw-agent"
+	}
+	if c.Logging.Heartbeat.MaxEntries == 0 {
+		c.Logging.Heartbeat.MaxEntries = 50
+	}
+	if c.Logging.Heartbeat.MaxBytes == 0 {
+		c.Logging.Heartbeat.MaxBytes = 8192
+	}
+	for _, limit := range []*RateLimit{
+		&c.Logging.RateLimit.Debug,
+		&c.Logging.RateLimit.Info,
+		&c.Logging.RateLimit.Warn,
+		&c.Logging.RateLimit.Error,
+	} {
+		if limit.WindowSeconds == 0 {
+			limit.WindowSeconds = 300
+		}
+		if limit.Burst == 0 {
+			limit.Burst = 1
+		}
+	}
+	if c.Payload.Mode == "" {
+		c.Payload.Mode = "full"
+	}
+	if c.Payload.FullSnapshotEvery == 0 {
+		c.Payload.FullSnapshotEvery = 20
+	}
+	if c.RemoteConfig.PollSeconds == 0 {
+		c.RemoteConfig.PollSeconds = 900
+	}
+	if c.RemoteConfig.RollbackAfterFailures == 0 {
+		c.RemoteConfig.RollbackAfterFailures = 3
+	}
+}
+
+func (c *Config) hasAPIURL(u string) bool {
+	if c.APIURL == u {
+		return true
+	}
+	for _, fallback := range c.APIURLFallbacks {
+		if fallback == u {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultDataDir() string {
+	if runtime.GOOS == "windows" {
+		return `C:\ProgramData\GWAgent\data`
+	}
+	return "/var/lib/gw-agent"
 }
 
 func joinErrors(errs []string) string {
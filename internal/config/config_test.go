@@ -1,9 +1,14 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/binary-gws/agent/internal/enrollment"
+	"github.com/binary-gws/agent/internal/remoteconfig"
 )
 
 func TestConfigValidation(t *testing.T) {
@@ -119,6 +124,235 @@ func TestConfigValidation(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "spki pins for unknown url",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				TLS: TLS{
+					SPKIPins: map[string][]string{
+						"https://other.example.com": {"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid spki pin",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				TLS: TLS{
+					SPKIPins: map[string][]string{
+						"https://api.example.com": {"not-a-pin"},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "valid spki pins with backup",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				TLS: TLS{
+					SPKIPins: map[string][]string{
+						"https://api.example.com": {
+							"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+							"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+						},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "invalid log level",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{Level: "verbose"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "log file size below -1",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{File: LogFile{Path: "/var/log/gw-agent/gw-agent.log", MaxSizeMB: -2}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "log file limits disabled",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{File: LogFile{Path: "/var/log/gw-agent/gw-agent.log", MaxAgeHours: -1, MaxFiles: -1}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "invalid log file compression",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{File: LogFile{Path: "/var/log/gw-agent/gw-agent.log", Compress: "zip"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid log format",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{Format: "logfmt"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid syslog network",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{Syslog: Syslog{Network: "tls", Address: "relay:6514"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "unknown syslog facility",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{Syslog: Syslog{Address: "127.0.0.1:514", Facility: "local9"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "negative rate limit burst",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				Logging: Logging{RateLimit: LogRateLimit{Error: RateLimit{Burst: -1}}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "token from file",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrentFile: "/etc/gw-agent/token",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "token with two sources",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent:    "test-token",
+					TokenCurrentEnv: "GW_TOKEN",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "remote config without public key",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				RemoteConfig: RemoteConfig{
+					URL: "https://api.example.com/config",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "remote config with invalid public key",
+			config: Config{
+				UUID:     "test-uuid",
+				ClientID: "test-client",
+				SiteID:   "test-site",
+				APIURL:   "https://api.example.com",
+				Auth: Auth{
+					TokenCurrent: "test-token",
+				},
+				RemoteConfig: RemoteConfig{
+					URL:       "https://api.example.com/config",
+					PublicKey: "c2hvcnQ=",
+				},
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -198,3 +432,217 @@ tls:
 		t.Errorf("expected HeartbeatSeconds=30, got %d", cfg.Intervals.HeartbeatSeconds)
 	}
 }
+
+func TestLoadConfigFromEnrollment(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	dataDir := filepath.Join(tmpDir, "data")
+
+	configContent := `
+site_id: configured-site
+api_url: https://api.example.com/heartbeat
+data_dir: ` + dataDir + `
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	if _, err := Load(configPath); err == nil {
+		t.Fatal("expected validation error before enrollment")
+	}
+
+	err := enrollment.Save(dataDir, &enrollment.State{
+		UUID:     "enrolled-uuid",
+		ClientID: "enrolled-client",
+		SiteID:   "enrolled-site",
+		Token:    "enrolled-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to save enrollment: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.UUID != "enrolled-uuid" || cfg.ClientID != "enrolled-client" {
+		t.Errorf("expected identity from enrollment, got uuid=%s client_id=%s", cfg.UUID, cfg.ClientID)
+	}
+	if cfg.SiteID != "configured-site" {
+		t.Errorf("expected site_id from config to win, got %s", cfg.SiteID)
+	}
+	if cfg.Auth.TokenCurrent != "enrolled-token" {
+		t.Error("expected token from enrollment")
+	}
+}
+
+func TestLoadCompleteConfigIgnoresEnrollment(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `
+uuid: test-gateway-123
+client_id: test-client
+site_id: test-site
+api_url: https://api.example.com/heartbeat
+data_dir: ` + tmpDir + `
+auth:
+  token_current: test-token
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, enrollment.FileName), []byte("{corrupt"), 0600); err != nil {
+		t.Fatalf("failed to write enrollment state: %v", err)
+	}
+
+	if _, err := Load(configPath); err != nil {
+		t.Fatalf("expected complete config to load despite corrupt enrollment state, got %v", err)
+	}
+}
+
+func TestLoadConfigTokenSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	tokenPath := filepath.Join(tmpDir, "token")
+
+	if err := os.WriteFile(tokenPath, []byte("file-token\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+	t.Setenv("GW_TEST_GRACE_TOKEN", "env-token")
+
+	configContent := `
+uuid: test-gateway-123
+client_id: test-client
+site_id: test-site
+api_url: https://api.example.com/heartbeat
+data_dir: ` + tmpDir + `
+auth:
+  token_current_file: ` + tokenPath + `
+  token_grace_env: GW_TEST_GRACE_TOKEN
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Auth.TokenCurrent != "file-token" {
+		t.Errorf("expected token from file, got %q", cfg.Auth.TokenCurrent)
+	}
+	if cfg.Auth.TokenGrace != "env-token" {
+		t.Errorf("expected grace token from env, got %q", cfg.Auth.TokenGrace)
+	}
+	if len(cfg.Secrets()) != 2 {
+		t.Errorf("expected 2 secrets, got %d", len(cfg.Secrets()))
+	}
+
+	os.Unsetenv("GW_TEST_GRACE_TOKEN")
+	if _, err := Load(configPath); err == nil {
+		t.Error("expected error when the token environment variable is unset")
+	}
+}
+
+func TestLoadConfigRemoteOverlay(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := `
+uuid: test-gateway-123
+client_id: test-client
+site_id: test-site
+api_url: https://api.example.com/heartbeat
+data_dir: ` + tmpDir + `
+auth:
+  token_current: secret-token
+intervals:
+  heartbeat_seconds: 30
+  compute_seconds: 60
+`
+	remote := `remote_config:
+  url: https://api.example.com/config
+  public_key: ` + base64.StdEncoding.EncodeToString(pub) + `
+`
+	writeFile(t, configPath, base+remote)
+
+	overlay := &remoteconfig.Bundle{Version: 4, Config: "intervals:\n  compute_seconds: 300\nmonitoring:\n  processes: [redis]\n"}
+	cfg, err := LoadWithOverlay(configPath, overlay)
+	if err != nil {
+		t.Fatalf("LoadWithOverlay failed: %v", err)
+	}
+	if cfg.Intervals.ComputeSeconds != 300 || cfg.Intervals.HeartbeatSeconds != 30 {
+		t.Errorf("expected overlay merged over file, got intervals %+v", cfg.Intervals)
+	}
+	if len(cfg.Monitoring.Processes) != 1 || cfg.Monitoring.Processes[0] != "redis" {
+		t.Errorf("expected processes from overlay, got %v", cfg.Monitoring.Processes)
+	}
+	if got := cfg.Origin("intervals.compute_seconds"); got != "remote config v4:2" {
+		t.Errorf("unexpected origin %q", got)
+	}
+	if cfg.RemoteConfig.PollSeconds != 900 || cfg.RemoteConfig.RollbackAfterFailures != 3 {
+		t.Errorf("unexpected remote config defaults %+v", cfg.RemoteConfig)
+	}
+
+	// Environment overrides still win over the overlay.
+	t.Setenv("GW_AGENT_INTERVALS_COMPUTE_SECONDS", "90")
+	cfg, err = LoadWithOverlay(configPath, overlay)
+	if err != nil {
+		t.Fatalf("LoadWithOverlay failed: %v", err)
+	}
+	if cfg.Intervals.ComputeSeconds != 90 {
+		t.Errorf("expected env to override overlay, got %d", cfg.Intervals.ComputeSeconds)
+	}
+
+	for _, bad := range []string{
+		"api_url: https://evil.example.com/\n",
+		"auth:\n  token_current: x\n",
+		"intervals:\n  heartbeat_secs: 5\n",
+		"intervals:\n  heartbeat_seconds: soon\n",
+		"intervals:\n  heartbeat_seconds: -5\n",
+		"logging:\n  file:\n    path: /etc/cron.d/x\n",
+	} {
+		if _, err := LoadWithOverlay(configPath, &remoteconfig.Bundle{Version: 5, Config: bad}); err == nil {
+			t.Errorf("expected overlay %q to be rejected", bad)
+		}
+	}
+	cfg, err = LoadWithOverlay(configPath, &remoteconfig.Bundle{Version: 5, Config: "logging:\n  level: debug\n"})
+	if err != nil {
+		t.Fatalf("expected logging.level overlay to apply, got %v", err)
+	}
+	if cfg.Logging.Level != "debug" {
+		t.Errorf("expected log level from overlay, got %q", cfg.Logging.Level)
+	}
+
+	// The stored overlay applies on a plain Load, but only while remote
+	// config is enabled.
+	store, err := remoteconfig.Open(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Activate(overlay); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("GW_AGENT_INTERVALS_COMPUTE_SECONDS")
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Intervals.ComputeSeconds != 300 {
+		t.Errorf("expected stored overlay applied, got %d", cfg.Intervals.ComputeSeconds)
+	}
+
+	writeFile(t, configPath, base)
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Intervals.ComputeSeconds != 60 {
+		t.Errorf("expected overlay ignored without remote_config.url, got %d", cfg.Intervals.ComputeSeconds)
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DropInDirName is the directory next to the main config file whose *.yaml
+// files are merged over it in lexical order.
+const DropInDirName = "conf.d"
+
+// OriginDefault is reported for values no file or variable has set.
+const OriginDefault = "default"
+
+// Files returns the main config file followed by its drop-ins in the order
+// they are merged.
+func Files(path string) ([]string, error) {
+	dropIns, err := filepath.Glob(filepath.Join(filepath.Dir(path), DropInDirName, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{path}, dropIns...), nil
+}
+
+// readMerged parses the main file and every drop-in and merges them:
+//
+//   - mappings are merged key by key, recursively
+//   - any other value, including a list, replaces the earlier one
+//   - an explicit null removes the earlier value, restoring the default
+//
+// origins records the file and line that set each leaf value.
+func readMerged(path string, lookup func(string) (string, bool), origins map[string]origin) (*yaml.Node, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drop-in files: %w", err)
+	}
+
+	var merged *yaml.Node
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", file, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("failed to parse config file %s: top level must be a mapping", file)
+		}
+		if err := expandNode(root, lookup); err != nil {
+			return nil, fmt.Errorf("failed to expand config file %s: %w", file, err)
+		}
+		merged = mergeNode(merged, root, file, "", origins)
+	}
+	return merged, nil
+}
+
+func mergeNode(dst, src *yaml.Node, file, path string, origins map[string]origin) *yaml.Node {
+	if dst == nil || dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		clearOrigins(origins, path)
+		recordOrigins(src, file, path, origins)
+		return src
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		childPath := joinPath(path, key.Value)
+
+		j := findKey(dst, key.Value)
+		if value.Kind == yaml.ScalarNode && value.ShortTag() == "!!null" {
+			if j >= 0 {
+				dst.Content = append(dst.Content[:j], dst.Content[j+2:]...)
+			}
+			clearOrigins(origins, childPath)
+			continue
+		}
+		if j >= 0 {
+			dst.Content[j+1] = mergeNode(dst.Content[j+1], value, file, childPath, origins)
+			continue
+		}
+		clearOrigins(origins, childPath)
+		recordOrigins(value, file, childPath, origins)
+		dst.Content = append(dst.Content, key, value)
+	}
+	return dst
+}
+
+func findKey(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func recordOrigins(node *yaml.Node, file, path string, origins map[string]origin) {
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			recordOrigins(node.Content[i+1], file, joinPath(path, node.Content[i].Value), origins)
+		}
+		return
+	}
+	origins[path] = origin{source: file, line: node.Line, column: node.Column}
+}
+
+func clearOrigins(origins map[string]origin, path string) {
+	for p := range origins {
+		if path == "" || p == path || strings.HasPrefix(p, path+".") {
+			delete(origins, p)
+		}
+	}
+}
+
+// origin is where a value was set: a file position, or a source such as an
+// environment variable with no position.
+type origin struct {
+	source       string
+	line, column int
+}
+
+func (o origin) String() string {
+	if o.line > 0 {
+		return fmt.Sprintf("%s:%d", o.source, o.line)
+	}
+	return o.source
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Origin returns where the effective value at path (e.g. "auth.token_current")
+// came from: "file:line", "env NAME", the enrollment state file, or
+// OriginDefault.
+func (c *Config) Origin(path string) string {
+	if o, ok := c.origins[path]; ok {
+		return o.String()
+	}
+	for p, o := range c.origins {
+		if strings.HasPrefix(p, path+".") {
+			return o.String()
+		}
+	}
+	return OriginDefault
+}
+
+// Annotated returns the config with secrets redacted as a YAML document
+// whose leaf values carry their origin as a line comment.
+func (c *Config) Annotated() (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := doc.Encode(c.Redacted()); err != nil {
+		return nil, err
+	}
+	c.annotate(&doc, "")
+	return &doc, nil
+}
+
+func (c *Config) annotate(node *yaml.Node, path string) {
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := joinPath(path, key.Value)
+			if value.Kind == yaml.MappingNode && len(value.Content) > 0 {
+				c.annotate(value, childPath)
+				continue
+			}
+			// Empty flow collections only keep a comment placed on the value.
+			if value.Kind != yaml.ScalarNode && len(value.Content) == 0 {
+				value.LineComment = c.Origin(childPath)
+				continue
+			}
+			key.LineComment = c.Origin(childPath)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		c.annotate(child, path)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadConfigDropIns(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	dropInDir := filepath.Join(tmpDir, DropInDirName)
+
+	writeFile(t, configPath, `
+uuid: test-gateway-123
+client_id: test-client
+site_id: test-site
+api_url: https://api.example.com/heartbeat
+api_url_fallbacks:
+  - https://backup.example.com/heartbeat
+data_dir: `+tmpDir+`
+auth:
+  token_current: secret-token
+intervals:
+  heartbeat_seconds: 30
+  compute_seconds: 60
+monitoring:
+  processes: [nginx]
+`)
+	// Lexical order: 20 overrides 10.
+	writeFile(t, filepath.Join(dropInDir, "20-site.yaml"), `
+intervals:
+  compute_seconds: 300
+monitoring:
+  processes: [worker, redis]
+`)
+	writeFile(t, filepath.Join(dropInDir, "10-defaults.yaml"), `
+intervals:
+  compute_seconds: 90
+api_url_fallbacks: null
+`)
+	writeFile(t, filepath.Join(dropInDir, "ignored.yml"), `
+site_id: should-not-apply
+`)
+
+	t.Setenv("GW_AGENT_SITE_ID", "env-site")
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.Intervals.HeartbeatSeconds != 30 {
+		t.Errorf("expected heartbeat_seconds kept from main file, got %d", cfg.Intervals.HeartbeatSeconds)
+	}
+	if cfg.Intervals.ComputeSeconds != 300 {
+		t.Errorf("expected compute_seconds from last drop-in, got %d", cfg.Intervals.ComputeSeconds)
+	}
+	if len(cfg.Monitoring.Processes) != 2 || cfg.Monitoring.Processes[0] != "worker" {
+		t.Errorf("expected process list replaced, got %v", cfg.Monitoring.Processes)
+	}
+	if len(cfg.APIURLFallbacks) != 0 {
+		t.Errorf("expected null to remove fallbacks, got %v", cfg.APIURLFallbacks)
+	}
+	if cfg.SiteID != "env-site" {
+		t.Errorf("expected env override, got %s", cfg.SiteID)
+	}
+
+	origins := map[string]string{
+		"uuid":                        configPath + ":2",
+		"intervals.heartbeat_seconds": configPath + ":12",
+		"intervals.compute_seconds":   filepath.Join(dropInDir, "20-site.yaml") + ":3",
+		"monitoring.processes":        filepath.Join(dropInDir, "20-site.yaml") + ":5",
+		"site_id":                     "env GW_AGENT_SITE_ID",
+		"api_url_fallbacks":           OriginDefault,
+		"payload.mode":                OriginDefault,
+	}
+	for path, want := range origins {
+		if got := cfg.Origin(path); got != want {
+			t.Errorf("origin of %s: expected %q, got %q", path, want, got)
+		}
+	}
+
+	doc, err := cfg.Annotated()
+	if err != nil {
+		t.Fatalf("failed to annotate config: %v", err)
+	}
+	if doc == nil || len(doc.Content) == 0 {
+		t.Fatal("expected annotated document")
+	}
+}
+
+func TestDropInMustBeMapping(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	writeFile(t, configPath, "uuid: test\n")
+	writeFile(t, filepath.Join(tmpDir, DropInDirName, "bad.yaml"), "- not\n- a mapping\n")
+
+	_, err := Parse(configPath)
+	if err == nil || !strings.Contains(err.Error(), "bad.yaml") {
+		t.Errorf("expected error naming the drop-in, got %v", err)
+	}
+}
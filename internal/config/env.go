@@ -0,0 +1,235 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables that override config
+// fields. The rest of the name is the YAML path upper-cased and joined with
+// underscores, e.g. GW_AGENT_AUTH_TOKEN_CURRENT for auth.token_current.
+const EnvPrefix = "GW_AGENT"
+
+// expandNode replaces ${VAR} and ${VAR:-default} in every scalar of the
+// document. Expansion happens after YAML parsing, so injected values can
+// never change the document structure.
+func expandNode(node *yaml.Node, lookup func(string) (string, bool)) error {
+	if node.Kind == yaml.ScalarNode {
+		expanded, err := expandString(node.Value, lookup)
+		if err != nil {
+			return &nodeError{line: node.Line, column: node.Column, err: err}
+		}
+		if expanded != node.Value {
+			node.Value = expanded
+			// Let plain scalars re-resolve so "${PORT}" can fill an int.
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := expandNode(child, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeError is an error at a position in a YAML document.
+type nodeError struct {
+	line, column int
+	err          error
+}
+
+func (e *nodeError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *nodeError) Unwrap() error {
+	return e.err
+}
+
+// expandString expands ${VAR} and ${VAR:-default}; "$$" is a literal "$".
+// A variable without a default must be set. ":-" also applies the default
+// when the variable is set but empty, as in the shell.
+func expandString(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		if s[i+1] != '{' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		expr := s[i+2 : i+2+end]
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		if !validEnvName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+
+		value, ok := lookup(name)
+		switch {
+		case ok && (value != "" || !hasDefault):
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		i += 2 + end
+	}
+	return b.String(), nil
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// tokenSourcePaths are the mutually exclusive sources of each token.
+var tokenSourcePaths = [][]string{
+	{"auth.token_current", "auth.token_current_file", "auth.token_current_env", "auth.token_current_command"},
+	{"auth.token_grace", "auth.token_grace_file", "auth.token_grace_env", "auth.token_grace_command"},
+}
+
+// applyEnvOverrides sets every field with a GW_AGENT_* variable in the
+// environment. Lists are comma separated or a YAML flow sequence; maps use
+// YAML flow syntax. Overriding one source of a token clears the other
+// sources of that token set in the files.
+func applyEnvOverrides(cfg *Config, lookup func(string) (string, bool)) error {
+	fromEnv := make(map[string]bool)
+	err := walkEnvFields(reflect.ValueOf(cfg).Elem(), EnvPrefix, "", func(name, path string, field reflect.Value) error {
+		raw, ok := lookup(name)
+		if !ok {
+			return nil
+		}
+		if err := setFromEnv(field, raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		cfg.setOrigin(path, "env "+name)
+		fromEnv[path] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	replaced := make(map[string]bool)
+	for _, paths := range tokenSourcePaths {
+		if !slices.ContainsFunc(paths, func(p string) bool { return fromEnv[p] }) {
+			continue
+		}
+		for _, p := range paths {
+			replaced[p] = !fromEnv[p]
+		}
+	}
+	return walkEnvFields(reflect.ValueOf(cfg).Elem(), EnvPrefix, "", func(_, path string, field reflect.Value) error {
+		if replaced[path] {
+			field.Set(reflect.Zero(field.Type()))
+			clearOrigins(cfg.origins, path)
+		}
+		return nil
+	})
+}
+
+// EnvVars returns the names of all override variables in field order.
+func EnvVars() []string {
+	var names []string
+	walkEnvFields(reflect.ValueOf(&Config{}).Elem(), EnvPrefix, "", func(name, _ string, _ reflect.Value) error {
+		names = append(names, name)
+		return nil
+	})
+	return names
+}
+
+func walkEnvFields(v reflect.Value, prefix, path string, fn func(name, path string, field reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		fieldPath := joinPath(path, tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := walkEnvFields(field, name, fieldPath, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(name, fieldPath, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFromEnv(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		trimmed := strings.TrimSpace(raw)
+		if strings.HasPrefix(trimmed, "[") {
+			return yaml.Unmarshal([]byte(trimmed), field.Addr().Interface())
+		}
+		var items []string
+		for _, item := range strings.Split(trimmed, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		field.Set(reflect.Zero(field.Type()))
+		return yaml.Unmarshal([]byte(raw), field.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
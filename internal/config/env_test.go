@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandString(t *testing.T) {
+	env := map[string]string{"HOST": "api.example.com", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		in        string
+		want      string
+		expectErr bool
+	}{
+		{in: "https://${HOST}/v1", want: "https://api.example.com/v1"},
+		{in: "${MISSING:-fallback}", want: "fallback"},
+		{in: "${EMPTY:-fallback}", want: "fallback"},
+		{in: "${EMPTY}", want: ""},
+		{in: "price $$5 and $PATH", want: "price $5 and $PATH"},
+		{in: "${MISSING}", expectErr: true},
+		{in: "${HOST", expectErr: true},
+		{in: "${1BAD}", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandString(tt.in, lookup)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEnvVarsUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, name := range EnvVars() {
+		if seen[name] {
+			t.Errorf("duplicate override variable %s", name)
+		}
+		seen[name] = true
+	}
+	for _, name := range []string{"GW_AGENT_UUID", "GW_AGENT_AUTH_TOKEN_CURRENT", "GW_AGENT_INTERVALS_HEARTBEAT_SECONDS", "GW_AGENT_TLS_SPKI_PINS"} {
+		if !seen[name] {
+			t.Errorf("expected override variable %s", name)
+		}
+	}
+}
+
+func TestLoadConfigEnvExpansionAndOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `
+uuid: test-gateway-123
+client_id: ${TEST_CLIENT_ID}
+site_id: ${TEST_SITE_ID:-default-site}
+api_url: https://api.example.com/heartbeat
+data_dir: ` + tmpDir + `
+auth:
+  token_current: file-token
+intervals:
+  heartbeat_seconds: ${TEST_HEARTBEAT:-30}
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	t.Setenv("TEST_CLIENT_ID", "expanded-client")
+	t.Setenv("TEST_HEARTBEAT", "45")
+	t.Setenv("GW_AGENT_AUTH_TOKEN_CURRENT", "env-token")
+	t.Setenv("GW_AGENT_API_URL_FALLBACKS", "https://a.example.com, https://b.example.com")
+	t.Setenv("GW_AGENT_TLS_INSECURE_SKIP_VERIFY", "true")
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.ClientID != "expanded-client" {
+		t.Errorf("expected expanded client_id, got %s", cfg.ClientID)
+	}
+	if cfg.SiteID != "default-site" {
+		t.Errorf("expected default site_id, got %s", cfg.SiteID)
+	}
+	if cfg.Intervals.HeartbeatSeconds != 45 {
+		t.Errorf("expected HeartbeatSeconds=45, got %d", cfg.Intervals.HeartbeatSeconds)
+	}
+	if cfg.Auth.TokenCurrent != "env-token" {
+		t.Error("expected GW_AGENT_AUTH_TOKEN_CURRENT to override the file")
+	}
+	if len(cfg.APIURLFallbacks) != 2 || cfg.APIURLFallbacks[1] != "https://b.example.com" {
+		t.Errorf("unexpected fallbacks: %v", cfg.APIURLFallbacks)
+	}
+	if !cfg.TLS.InsecureSkipVerify {
+		t.Error("expected insecure_skip_verify override")
+	}
+	if cfg.Redacted().Auth.TokenCurrent != "[REDACTED]" {
+		t.Error("expected token to be redacted")
+	}
+
+	t.Setenv("GW_AGENT_INTERVALS_HEARTBEAT_SECONDS", "often")
+	if _, err := Load(configPath); err == nil {
+		t.Error("expected error for non-integer override")
+	}
+}
+
+func TestEnvOverrideReplacesTokenSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	tokenPath := filepath.Join(tmpDir, "token")
+	if err := os.WriteFile(tokenPath, []byte("file-token\n"), 0600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	configContent := `
+uuid: test-gateway-123
+client_id: test-client
+site_id: test-site
+api_url: https://api.example.com/heartbeat
+data_dir: ` + tmpDir + `
+auth:
+  token_current_file: ` + tokenPath + `
+  token_grace: file-grace
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	t.Setenv("GW_AGENT_AUTH_TOKEN_CURRENT", "env-token")
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Auth.TokenCurrent != "env-token" || cfg.Auth.TokenCurrentFile != "" {
+		t.Errorf("expected env token to replace the token file, got token=%q file=%q", cfg.Auth.TokenCurrent, cfg.Auth.TokenCurrentFile)
+	}
+	if cfg.Auth.TokenGrace != "file-grace" {
+		t.Errorf("expected grace token to be kept, got %q", cfg.Auth.TokenGrace)
+	}
+
+	// Two sources of the same token from the environment still conflict.
+	t.Setenv("GW_AGENT_AUTH_TOKEN_CURRENT_FILE", tokenPath)
+	if _, err := Load(configPath); err == nil {
+		t.Error("expected error for two token sources in the environment")
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RemotePaths are the settings a remote config overlay may set, with
+// everything below them, all of which apply without a restart. Endpoints,
+// credentials, TLS, identity, data_dir and file paths stay local, so a
+// bundle can never redirect the agent, lock it out or write elsewhere.
+var RemotePaths = []string{"intervals", "monitoring", "logging.level", "compression"}
+
+// parseOverlay parses a remote overlay strictly: unknown keys, mistyped
+// values and settings outside RemotePaths are errors. Unlike local files,
+// an overlay is not ${VAR} expanded. It returns nil for an empty overlay.
+func parseOverlay(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("top level must be a mapping")
+	}
+
+	if errs := checkOverlay(root, reflect.TypeOf(Config{}), ""); len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return root, nil
+}
+
+func checkOverlay(node *yaml.Node, t reflect.Type, path string) []string {
+	var errs []string
+	fields := yamlFields(t)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		childPath := joinPath(path, key.Value)
+		field, known := fields[key.Value]
+		switch {
+		case known && slices.Contains(RemotePaths, childPath):
+			for _, d := range checkNode(value, field, childPath) {
+				errs = append(errs, fmt.Sprintf("line %d: %s", d.Line, d.Message))
+			}
+		case known && value.Kind == yaml.MappingNode && remoteParent(childPath):
+			errs = append(errs, checkOverlay(value, field, childPath)...)
+		default:
+			errs = append(errs, fmt.Sprintf("line %d: %s cannot be set remotely", key.Line, childPath))
+		}
+	}
+	return errs
+}
+
+// remoteParent reports whether some RemotePaths entry lies below path.
+func remoteParent(path string) bool {
+	for _, p := range RemotePaths {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
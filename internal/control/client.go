@@ -0,0 +1,81 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Client talks to a running agent's control socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the socket at path.
+func NewClient(path string) *Client {
+	return &Client{http: &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}}
+}
+
+// LogLevel returns the agent's current log level.
+func (c *Client) LogLevel(ctx context.Context) (*LogLevel, error) {
+	return c.do(ctx, http.MethodGet, nil)
+}
+
+// SetLogLevel changes the log level for d, or ends a temporary change if
+// level is "reset".
+func (c *Client) SetLogLevel(ctx context.Context, level string, d time.Duration) (*LogLevel, error) {
+	return c.do(ctx, http.MethodPut, &SetLogLevel{Level: level, DurationSeconds: int(d.Seconds())})
+}
+
+func (c *Client) do(ctx context.Context, method string, body interface{}) (*LogLevel, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	// The host is ignored; every request goes to the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://agent/v1/log-level", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("agent rejected request: %s", e.Error)
+		}
+		return nil, fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+	var status LogLevel
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &status, nil
+}
@@ -0,0 +1,143 @@
+// Package control serves a local HTTP interface on a Unix socket in
+// data_dir, through which operators can adjust the running agent.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/binary-gws/agent/internal/logging"
+)
+
+// SocketName is the control socket's file name in data_dir.
+const SocketName = "control.sock"
+
+// SocketPath returns the control socket path for dataDir.
+func SocketPath(dataDir string) string {
+	return filepath.Join(dataDir, SocketName)
+}
+
+// LogLevel is the body of GET and PUT /v1/log-level responses.
+type LogLevel struct {
+	Level string `json:"level"`
+	// BaseLevel and RevertAt are set while a temporary level is active.
+	BaseLevel string     `json:"base_level,omitempty"`
+	RevertAt  *time.Time `json:"revert_at,omitempty"`
+}
+
+// SetLogLevel is the body of PUT /v1/log-level. Level "reset" ends a
+// temporary change early.
+type SetLogLevel struct {
+	Level           string `json:"level"`
+	DurationSeconds int    `json:"duration_seconds,omitempty"`
+}
+
+// Server serves the control interface.
+type Server struct {
+	logger   *logging.Logger
+	listener net.Listener
+	server   *http.Server
+}
+
+// Listen creates the socket at path, readable and writable by the owner
+// only. A socket left behind by an agent that is no longer running is
+// replaced.
+func Listen(path string, logger *logging.Logger) (*Server, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another agent", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create control socket directory: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+
+	s := &Server{logger: logger, listener: listener}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/log-level", s.getLogLevel)
+	mux.HandleFunc("PUT /v1/log-level", s.putLogLevel)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return s, nil
+}
+
+// Serve handles requests until ctx is done.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.server.Close()
+	}()
+	err := s.server.Serve(s.listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.logLevel())
+}
+
+func (s *Server) putLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req SetLogLevel
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+		return
+	}
+	if req.Level == "reset" {
+		s.logger.RevertLevel()
+		s.logger.Warn("Log level reset through control socket", map[string]interface{}{
+			"log_level": s.logger.Level().String(),
+		})
+		writeJSON(w, http.StatusOK, s.logLevel())
+		return
+	}
+	level, ok := logging.LookupLevel(req.Level)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown level %q", req.Level))
+		return
+	}
+	duration := logging.LevelTimeout(time.Duration(req.DurationSeconds) * time.Second)
+	s.logger.SetLevelFor(level, duration)
+	s.logger.Warn("Log level changed through control socket", map[string]interface{}{
+		"log_level":        level.String(),
+		"duration_seconds": int(duration.Seconds()),
+	})
+	writeJSON(w, http.StatusOK, s.logLevel())
+}
+
+func (s *Server) logLevel() LogLevel {
+	status := LogLevel{Level: s.logger.Level().String()}
+	if base, revertAt, ok := s.logger.TemporaryLevel(); ok {
+		status.BaseLevel = base.String()
+		status.RevertAt = &revertAt
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,97 @@
+package control
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/binary-gws/agent/internal/logging"
+)
+
+func startServer(t *testing.T, path string, logger *logging.Logger) {
+	t.Helper()
+	srv, err := Listen(path, logger)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.Serve(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestLogLevel(t *testing.T) {
+	path := SocketPath(t.TempDir())
+	logger := logging.New(logging.LevelInfo, io.Discard, "test-uuid")
+	startServer(t, path, logger)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("control socket should be owner-only, got %v", info.Mode().Perm())
+	}
+
+	client := NewClient(path)
+	ctx := context.Background()
+
+	status, err := client.LogLevel(ctx)
+	if err != nil {
+		t.Fatalf("LogLevel failed: %v", err)
+	}
+	if status.Level != "INFO" || status.RevertAt != nil {
+		t.Errorf("unexpected initial status %+v", status)
+	}
+
+	status, err = client.SetLogLevel(ctx, "debug", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("SetLogLevel failed: %v", err)
+	}
+	if status.Level != "DEBUG" || status.BaseLevel != "INFO" || status.RevertAt == nil {
+		t.Errorf("expected temporary debug level, got %+v", status)
+	}
+	if until := time.Until(*status.RevertAt); until < 9*time.Minute || until > 10*time.Minute {
+		t.Errorf("expected revert in about 10 minutes, got %v", until)
+	}
+	if logger.Level() != logging.LevelDebug {
+		t.Errorf("expected logger at DEBUG, got %v", logger.Level())
+	}
+
+	if _, err := client.SetLogLevel(ctx, "verbose", 0); err == nil {
+		t.Error("expected error for unknown level")
+	}
+
+	status, err = client.SetLogLevel(ctx, "reset", 0)
+	if err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if status.Level != "INFO" || status.RevertAt != nil {
+		t.Errorf("expected INFO after reset, got %+v", status)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SocketName)
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	logger := logging.New(logging.LevelInfo, io.Discard, "test-uuid")
+	startServer(t, path, logger)
+
+	if _, err := Listen(path, logger); err == nil {
+		t.Error("expected error while another agent holds the socket")
+	}
+	if _, err := NewClient(path).LogLevel(context.Background()); err != nil {
+		t.Errorf("first server should still be reachable: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package credentials
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/binary-gws/agent/internal/fileutil"
+)
+
+const FileName = "tokens.json"
+
+// State is the persisted result of backend-driven token rotation.
+type State struct {
+	Current string `json:"current"`
+	Grace   string `json:"grace,omitempty"`
+	// ConfigFingerprint is the fingerprint of auth.token_current at the time
+	// of the first rotation. If the operator later changes the config token,
+	// the stored state is discarded in favour of the config.
+	ConfigFingerprint string `json:"config_fingerprint"`
+	RotatedAt         string `json:"rotated_at"`
+	DirectiveID       string `json:"directive_id,omitempty"`
+	Confirmed         bool   `json:"confirmed"`
+}
+
+// Store keeps rotated tokens in a 0600 file under the data directory.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	state *State
+}
+
+// Fingerprint returns a short, non-reversible identifier for token that is
+// safe to log and report.
+func Fingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Open loads the token state in dir. State recorded against a different
+// config token than configToken is ignored.
+func Open(dir, configToken string) (*Store, error) {
+	st := &Store{path: filepath.Join(dir, FileName)}
+
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("failed to read token state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return st, fmt.Errorf("failed to parse token state: %w", err)
+	}
+	if state.Current == "" || state.ConfigFingerprint != Fingerprint(configToken) {
+		return st, nil
+	}
+	st.state = &state
+	return st, nil
+}
+
+// Tokens returns the stored current and grace tokens, or ok=false if no
+// rotation has happened since the config token was last set.
+func (st *Store) Tokens() (current, grace string, ok bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state == nil {
+		return "", "", false
+	}
+	return st.state.Current, st.state.Grace, true
+}
+
+// State returns a copy of the stored state, or nil.
+func (st *Store) State() *State {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state == nil {
+		return nil
+	}
+	state := *st.state
+	return &state
+}
+
+// Rotate persists newToken as current with previous as grace, pending
+// confirmation. configToken anchors the state to the config it replaced.
+func (st *Store) Rotate(newToken, previous, configToken, directiveID string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	state := &State{
+		Current:           newToken,
+		Grace:             previous,
+		ConfigFingerprint: Fingerprint(configToken),
+		RotatedAt:         time.Now().UTC().Format(time.RFC3339),
+		DirectiveID:       directiveID,
+	}
+	if st.state != nil {
+		state.ConfigFingerprint = st.state.ConfigFingerprint
+	}
+	if err := st.save(state); err != nil {
+		return err
+	}
+	st.state = state
+	return nil
+}
+
+// Confirm drops the grace token once the backend has confirmed the current
+// one.
+func (st *Store) Confirm() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state == nil {
+		return fmt.Errorf("no token rotation in progress")
+	}
+	state := *st.state
+	state.Grace = ""
+	state.Confirmed = true
+	if err := st.save(&state); err != nil {
+		return err
+	}
+	st.state = &state
+	return nil
+}
+
+// Discard forgets any rotated tokens, for example after the operator has
+// changed the config token.
+func (st *Store) Discard() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.state = nil
+	if err := os.Remove(st.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove token state: %w", err)
+	}
+	return nil
+}
+
+func (st *Store) save(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFileAtomic(st.path, data); err != nil {
+		return fmt.Errorf("failed to write token state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateAndConfirm(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := Open(dir, "config-token")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if _, _, ok := st.Tokens(); ok {
+		t.Fatal("expected no stored tokens initially")
+	}
+
+	if err := st.Rotate("new-token", "config-token", "config-token", "d1"); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatalf("token file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected token file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	reopened, err := Open(dir, "config-token")
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	current, grace, ok := reopened.Tokens()
+	if !ok || current != "new-token" || grace != "config-token" {
+		t.Errorf("unexpected tokens after reopen: ok=%v", ok)
+	}
+	if reopened.State().Confirmed {
+		t.Error("rotation should be pending until confirmed")
+	}
+
+	if err := reopened.Confirm(); err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	current, grace, _ = reopened.Tokens()
+	if current != "new-token" || grace != "" {
+		t.Error("expected grace token dropped after confirm")
+	}
+}
+
+func TestConfigTokenChangeDiscardsState(t *testing.T) {
+	dir := t.TempDir()
+
+	st, _ := Open(dir, "config-token")
+	if err := st.Rotate("new-token", "config-token", "config-token", "d1"); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	reopened, err := Open(dir, "operator-set-token")
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	if _, _, ok := reopened.Tokens(); ok {
+		t.Error("expected stored tokens ignored after config token change")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("") != "" {
+		t.Error("expected empty fingerprint for empty token")
+	}
+	fp := Fingerprint("secret")
+	if len(fp) != 12 || fp == "secret" {
+		t.Errorf("unexpected fingerprint %q", fp)
+	}
+}
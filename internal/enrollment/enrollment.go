@@ -0,0 +1,142 @@
+package enrollment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/binary-gws/agent/internal/fileutil"
+)
+
+const FileName = "enrollment.json"
+
+// State is the identity and credential issued by the registration endpoint.
+type State struct {
+	UUID       string `json:"uuid"`
+	ClientID   string `json:"client_id"`
+	SiteID     string `json:"site_id"`
+	Token      string `json:"token"`
+	EnrolledAt string `json:"enrolled_at"`
+}
+
+// Request is sent to the registration endpoint. The bootstrap code is
+// short-lived and single-use; the backend invalidates it on success.
+type Request struct {
+	BootstrapCode string `json:"bootstrap_code"`
+	Hostname      string `json:"hostname,omitempty"`
+	Platform      string `json:"platform,omitempty"`
+	AgentVersion  string `json:"agent_version,omitempty"`
+	// PublicKey is the base64 device public key the backend uses to verify
+	// signed heartbeats.
+	PublicKey    string `json:"public_key,omitempty"`
+	KeyAlgorithm string `json:"key_algorithm,omitempty"`
+	KeyID        string `json:"key_id,omitempty"`
+}
+
+type response struct {
+	UUID     string `json:"uuid"`
+	ClientID string `json:"client_id"`
+	SiteID   string `json:"site_id"`
+	Token    string `json:"token"`
+}
+
+// Load returns the enrollment state stored in dir, or nil if the agent has
+// not been enrolled.
+func Load(dir string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrollment state: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment state: %w", err)
+	}
+	return &state, nil
+}
+
+// Save writes state to dir with owner-only permissions.
+func Save(dir string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFileAtomic(filepath.Join(dir, FileName), data); err != nil {
+		return fmt.Errorf("failed to write enrollment state: %w", err)
+	}
+	return nil
+}
+
+// Enroll exchanges a bootstrap code for the gateway identity and a
+// long-lived token.
+func Enroll(ctx context.Context, client *http.Client, url string, req Request) (*State, error) {
+	if strings.TrimSpace(req.BootstrapCode) == "" {
+		return nil, fmt.Errorf("bootstrap code is required")
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return nil, fmt.Errorf("bootstrap code rejected: HTTP %d", resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("enrollment failed: HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var r response
+	if err := json.Unmarshal(respBody, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment response: %w", err)
+	}
+	var missing []string
+	if r.UUID == "" {
+		missing = append(missing, "uuid")
+	}
+	if r.ClientID == "" {
+		missing = append(missing, "client_id")
+	}
+	if r.SiteID == "" {
+		missing = append(missing, "site_id")
+	}
+	if r.Token == "" {
+		missing = append(missing, "token")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("enrollment response missing %s", strings.Join(missing, ", "))
+	}
+
+	return &State{
+		UUID:       r.UUID,
+		ClientID:   r.ClientID,
+		SiteID:     r.SiteID,
+		Token:      r.Token,
+		EnrolledAt: time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,94 @@
+package enrollment
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnrollSuccess(t *testing.T) {
+	var got Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"uuid":"gw-1","client_id":"c-1","site_id":"s-1","token":"tok"}`))
+	}))
+	defer server.Close()
+
+	state, err := Enroll(context.Background(), server.Client(), server.URL, Request{
+		BootstrapCode: "ABCD-1234",
+		Hostname:      "gw01",
+	})
+	if err != nil {
+		t.Fatalf("enroll failed: %v", err)
+	}
+	if got.BootstrapCode != "ABCD-1234" || got.Hostname != "gw01" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if state.UUID != "gw-1" || state.ClientID != "c-1" || state.SiteID != "s-1" || state.Token != "tok" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	if state.EnrolledAt == "" {
+		t.Error("expected enrolled_at to be set")
+	}
+}
+
+func TestEnrollRejectedCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := Enroll(context.Background(), server.Client(), server.URL, Request{BootstrapCode: "used"})
+	if err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("expected rejected error, got %v", err)
+	}
+}
+
+func TestEnrollMissingFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"uuid":"gw-1"}`))
+	}))
+	defer server.Close()
+
+	_, err := Enroll(context.Background(), server.Client(), server.URL, Request{BootstrapCode: "code"})
+	if err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("expected missing fields error, got %v", err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	state, err := Load(dir)
+	if err != nil || state != nil {
+		t.Fatalf("expected no state before enrollment, got %v, %v", state, err)
+	}
+
+	if err := Save(dir, &State{UUID: "gw-1", ClientID: "c-1", SiteID: "s-1", Token: "tok"}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatalf("state file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	state, err = Load(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if state.UUID != "gw-1" || state.Token != "tok" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
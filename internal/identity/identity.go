@@ -0,0 +1,128 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	KeyFileName = "device_key.pem"
+	Algorithm   = "ed25519"
+)
+
+// Identity is the per-device Ed25519 keypair. The private key never leaves
+// the data directory; the public key is registered with the backend at
+// enrollment.
+type Identity struct {
+	privateKey ed25519.PrivateKey
+	keyID      string
+}
+
+// LoadOrCreate loads the device key from dir, generating and storing a new
+// one on first run. The key file is written with owner-only permissions.
+func LoadOrCreate(dir string) (*Identity, error) {
+	path := filepath.Join(dir, KeyFileName)
+
+	id, err := load(path)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	// O_EXCL so two processes starting at once cannot overwrite each
+	// other's key; the loser loads the winner's.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return load(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write device key: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write device key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write device key: %w", err)
+	}
+
+	return newIdentity(priv), nil
+}
+
+func load(path string) (*Identity, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("device key %s must not be accessible by group or others (mode %v)", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("device key %s is not a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("device key %s is not an Ed25519 key", path)
+	}
+	return newIdentity(priv), nil
+}
+
+func newIdentity(priv ed25519.PrivateKey) *Identity {
+	pub := priv.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(pub)
+	return &Identity{
+		privateKey: priv,
+		keyID:      hex.EncodeToString(sum[:])[:16],
+	}
+}
+
+// KeyID is a short fingerprint of the public key sent with every signed
+// request so the backend can find the registered key.
+func (id *Identity) KeyID() string {
+	return id.keyID
+}
+
+// PublicKey returns the raw 32-byte public key, base64 encoded.
+func (id *Identity) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(id.privateKey.Public().(ed25519.PublicKey))
+}
+
+func (id *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(id.privateKey, message)
+}
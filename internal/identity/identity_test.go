@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreatePersistsKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	first, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("failed to create identity: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, KeyFileName))
+	if err != nil {
+		t.Fatalf("key file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	second, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("failed to load identity: %v", err)
+	}
+	if first.PublicKey() != second.PublicKey() || first.KeyID() != second.KeyID() {
+		t.Error("expected the stored key to be reused")
+	}
+}
+
+func TestSignVerifies(t *testing.T) {
+	id, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create identity: %v", err)
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(id.PublicKey())
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		t.Fatalf("invalid public key encoding: %v", err)
+	}
+	msg := []byte("hello")
+	if !ed25519.Verify(pub, msg, id.Sign(msg)) {
+		t.Error("signature did not verify")
+	}
+}
+
+func TestLoadRejectsPermissiveKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadOrCreate(dir); err != nil {
+		t.Fatalf("failed to create identity: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, KeyFileName), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreate(dir); err == nil {
+		t.Error("expected error for world-readable key file")
+	}
+}
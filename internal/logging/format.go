@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format int
+
+const (
+	// FormatJSON writes one JSON object per line (default).
+	FormatJSON Format = iota
+	// FormatText writes "time LEVEL msg key=value ..." lines for reading
+	// on a console, colored when the output is a terminal.
+	FormatText
+)
+
+// ParseFormat parses "json" or "text"; "" is JSON.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return FormatJSON, nil
+	case "text":
+		return FormatText, nil
+	default:
+		return FormatJSON, fmt.Errorf("unknown log format %q", s)
+	}
+}
+
+// SetFormat changes the format of the logger's output. Sinks are not
+// affected. Colors are used for FormatText when the output is a terminal
+// and NO_COLOR is not set.
+func (l *Logger) SetFormat(f Format) {
+	l.format.Store(int32(f))
+	l.color.Store(f == FormatText && isTerminal(l.output) && os.Getenv("NO_COLOR") == "")
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+	ansiBold  = "\x1b[1m"
+)
+
+func levelColor(level Level) string {
+	switch level {
+	case LevelDebug:
+		return "\x1b[90m"
+	case LevelInfo:
+		return "\x1b[32m"
+	case LevelWarn:
+		return "\x1b[33m"
+	default:
+		return "\x1b[31m"
+	}
+}
+
+func (l *Logger) formatText(now time.Time, level Level, msg string, fields map[string]interface{}) string {
+	color := l.color.Load()
+	var b strings.Builder
+	stamp := now.Format(time.RFC3339)
+	levelName := fmt.Sprintf("%-5s", level.String())
+	if color {
+		b.WriteString(ansiDim + stamp + ansiReset + " ")
+		b.WriteString(levelColor(level) + levelName + ansiReset + " ")
+		b.WriteString(ansiBold + msg + ansiReset)
+	} else {
+		b.WriteString(stamp + " " + levelName + " " + msg)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(' ')
+		if color {
+			b.WriteString(ansiDim + k + "=" + ansiReset)
+		} else {
+			b.WriteString(k + "=")
+		}
+		b.WriteString(quoteTextValue(formatValue(fields[k])))
+	}
+	return b.String()
+}
+
+// quoteTextValue quotes values that would otherwise be ambiguous in a
+// key=value line.
+func quoteTextValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n\r") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
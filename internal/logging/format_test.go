@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWithBindsFields(t *testing.T) {
+	var buf bytes.Buffer
+	root := New(LevelInfo, &buf, "test-uuid")
+	child := root.With("component", "transport", "endpoint", "https://api.example.com")
+	grandchild := child.With("endpoint", "https://fallback.example.com")
+
+	grandchild.Info("Sent", map[string]interface{}{"component": "override"})
+	child.Info("Sent", nil)
+	root.Info("Plain", nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), buf.String())
+	}
+	var entries [3]map[string]interface{}
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+	}
+
+	if entries[0]["component"] != "override" || entries[0]["endpoint"] != "https://fallback.example.com" {
+		t.Errorf("expected call fields over rebound fields, got %v", entries[0])
+	}
+	if entries[1]["component"] != "transport" || entries[1]["endpoint"] != "https://api.example.com" {
+		t.Errorf("expected child's bound fields, got %v", entries[1])
+	}
+	if _, ok := entries[2]["component"]; ok {
+		t.Errorf("expected root logger without bound fields, got %v", entries[2])
+	}
+
+	// Children share the level with their parent.
+	root.SetLevel(LevelError)
+	child.Info("Dropped", nil)
+	if strings.Contains(buf.String(), "Dropped") {
+		t.Error("expected child to follow the parent's level")
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(LevelDebug, &buf, "test-uuid")
+	l.SetFormat(FormatText)
+	l.With("component", "scheduler").Warn("Heartbeat failed", map[string]interface{}{
+		"error":   "connection refused",
+		"attempt": 3,
+	})
+
+	line := strings.TrimSpace(buf.String())
+	if strings.Contains(line, "\x1b[") {
+		t.Errorf("expected no colors when not writing to a terminal, got %q", line)
+	}
+	want := `WARN  Heartbeat failed attempt=3 component=scheduler error="connection refused"`
+	if !strings.HasSuffix(line, want) {
+		t.Errorf("expected line ending in %q, got %q", want, line)
+	}
+	if strings.HasPrefix(line, "{") {
+		t.Errorf("expected text, got JSON %q", line)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": FormatJSON, "json": FormatJSON, "TEXT": FormatText} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("logfmt"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,186 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// JournalSocket is where journald accepts native protocol datagrams.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// Journal sends entries to journald over its native protocol, so each one
+// keeps its priority and fields instead of arriving as an opaque line.
+type Journal struct {
+	addr       *net.UnixAddr
+	identifier string
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// OpenJournal connects to the local journald. identifier becomes
+// SYSLOG_IDENTIFIER on every entry.
+func OpenJournal(identifier string) (*Journal, error) {
+	return openJournal(JournalSocket, identifier)
+}
+
+func openJournal(socket, identifier string) (*Journal, error) {
+	j := &Journal{
+		addr:       &net.UnixAddr{Name: socket, Net: "unixgram"},
+		identifier: identifier,
+	}
+	if err := j.dial(); err != nil {
+		return nil, fmt.Errorf("journald is not available: %w", err)
+	}
+	return j, nil
+}
+
+func (j *Journal) dial() error {
+	conn, err := net.DialUnix("unixgram", nil, j.addr)
+	if err != nil {
+		return err
+	}
+	j.conn = conn
+	return nil
+}
+
+// WriteEntry implements Sink. MESSAGE and MSG both carry the message;
+// custom fields are upper-cased, e.g. consecutive_failures becomes
+// CONSECUTIVE_FAILURES.
+func (j *Journal) WriteEntry(e *Entry) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", e.Msg)
+	writeJournalField(&buf, "MSG", e.Msg)
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(e.Level.syslogSeverity()))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", j.identifier)
+	writeJournalField(&buf, "GATEWAY_UUID", e.UUID)
+	writeJournalField(&buf, "LEVEL", e.Level.String())
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := journalFieldName(k)
+		if name == "" {
+			continue
+		}
+		writeJournalField(&buf, name, e.Fields[k])
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		if err := j.dial(); err != nil {
+			return err
+		}
+	}
+	_, err := j.conn.Write(buf.Bytes())
+	if err == nil {
+		return nil
+	}
+	// Entries too large for a datagram are passed as a file descriptor
+	// instead, as sd_journal_send does.
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		return j.sendViaFile(buf.Bytes())
+	}
+	// journald may have restarted; dial again on the next entry.
+	j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+func (j *Journal) sendViaFile(data []byte) error {
+	f, err := os.CreateTemp("/dev/shm", "gw-agent-journal-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	_, _, err = j.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), nil)
+	return err
+}
+
+// Close implements io.Closer.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+// writeJournalField appends one field in the native protocol's format.
+// Values containing a newline are length-prefixed.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName converts a field key to a valid journal field name:
+// upper-case letters, digits and underscores, not starting with an
+// underscore or digit and at most 64 characters. It returns "" for keys
+// that would clash with the fields set by WriteEntry.
+func journalFieldName(key string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(key) {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	switch name {
+	case "MESSAGE", "MSG", "PRIORITY", "SYSLOG_IDENTIFIER", "GATEWAY_UUID", "LEVEL":
+		return ""
+	}
+	return name
+}
+
+// StdoutIsJournal reports whether stdout is connected to journald, as it is
+// for a systemd service by default. Writing JSON lines there as well would
+// duplicate every entry in the journal.
+func StdoutIsJournal() bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	dev, ino, ok := strings.Cut(stream, ":")
+	if !ok {
+		return false
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stdout.Fd()), &st); err != nil {
+		return false
+	}
+	return strconv.FormatUint(uint64(st.Dev), 10) == dev && strconv.FormatUint(uint64(st.Ino), 10) == ino
+}
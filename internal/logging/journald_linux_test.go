@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// parseJournalFields decodes a native protocol datagram.
+func parseJournalFields(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			t.Fatalf("truncated field in %q", data)
+		}
+		line := data[:nl]
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			fields[string(line[:eq])] = string(line[eq+1:])
+			data = data[nl+1:]
+			continue
+		}
+		data = data[nl+1:]
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[string(line)] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestJournalWriteEntry(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	journal, err := openJournal(socket, "gw-agent")
+	if err != nil {
+		t.Fatalf("openJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	logger := New(LevelDebug, io.Discard, "gateway-uuid-1234")
+	logger.AddSink(journal)
+	logger.Warn("Heartbeat failed", map[string]interface{}{
+		"consecutive_failures": 3,
+		"error":                "line one\nline two",
+		"token":                "never sent",
+		"_private":             "x",
+	})
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("no datagram received: %v", err)
+	}
+	fields := parseJournalFields(t, buf[:n])
+
+	want := map[string]string{
+		"MESSAGE":              "Heartbeat failed",
+		"MSG":                  "Heartbeat failed",
+		"PRIORITY":             "4",
+		"SYSLOG_IDENTIFIER":    "gw-agent",
+		"GATEWAY_UUID":         "gate...1234",
+		"CONSECUTIVE_FAILURES": "3",
+		"ERROR":                "line one\nline two",
+		"PRIVATE":              "x",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, fields[k], v)
+		}
+	}
+	if fields["TOKEN"] != "[REDACTED]" {
+		t.Errorf("expected token field masked, got %q", fields["TOKEN"])
+	}
+}
+
+func TestOpenJournalWithoutSocket(t *testing.T) {
+	if _, err := openJournal(filepath.Join(t.TempDir(), "missing.sock"), "gw-agent"); err == nil {
+		t.Error("expected error when journald is not running")
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	for key, want := range map[string]string{
+		"last_success_at": "LAST_SUCCESS_AT",
+		"http.status":     "HTTP_STATUS",
+		"9lives":          "LIVES",
+		"msg":             "",
+		"priority":        "",
+	} {
+		if got := journalFieldName(key); got != want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package logging
+
+import "fmt"
+
+// JournalSocket is where journald accepts native protocol datagrams.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// Journal is only available on Linux.
+type Journal struct{}
+
+// OpenJournal always fails outside Linux.
+func OpenJournal(identifier string) (*Journal, error) {
+	return nil, fmt.Errorf("journald is only supported on Linux")
+}
+
+// WriteEntry implements Sink.
+func (j *Journal) WriteEntry(e *Entry) error {
+	return fmt.Errorf("journald is only supported on Linux")
+}
+
+// Close implements io.Closer.
+func (j *Journal) Close() error {
+	return nil
+}
+
+// StdoutIsJournal always reports false outside Linux.
+func StdoutIsJournal() bool {
+	return false
+}
@@ -2,10 +2,13 @@ package logging
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,35 +37,194 @@ func (l Level) String() string {
 }
 
 func ParseLevel(s string) Level {
+	level, ok := LookupLevel(s)
+	if !ok {
+		return LevelInfo
+	}
+	return level
+}
+
+// LookupLevel is like ParseLevel but reports whether s names a level.
+func LookupLevel(s string) (Level, bool) {
 	switch strings.ToUpper(s) {
 	case "DEBUG":
-		return LevelDebug
+		return LevelDebug, true
 	case "INFO":
-		return LevelInfo
+		return LevelInfo, true
 	case "WARN", "WARNING":
-		return LevelWarn
+		return LevelWarn, true
 	case "ERROR":
-		return LevelError
+		return LevelError, true
 	default:
-		return LevelInfo
+		return LevelInfo, false
 	}
 }
 
+const (
+	// DefaultLevelTimeout is how long a temporary level change lasts when
+	// no duration is given.
+	DefaultLevelTimeout = 15 * time.Minute
+	// MaxLevelTimeout caps temporary level changes.
+	MaxLevelTimeout = 24 * time.Hour
+)
+
+// LevelTimeout returns d, or DefaultLevelTimeout if d is not positive,
+// capped at MaxLevelTimeout.
+func LevelTimeout(d time.Duration) time.Duration {
+	if d <= 0 {
+		return DefaultLevelTimeout
+	}
+	return min(d, MaxLevelTimeout)
+}
+
+// Logger writes structured entries. Loggers derived with With share
+// everything but their bound fields with the logger they came from.
 type Logger struct {
-	level  Level
+	*core
+	fields map[string]interface{}
+}
+
+type core struct {
+	level  atomic.Int32
 	logger *log.Logger
+	output io.Writer
 	uuid   string
+
+	format atomic.Int32
+	color  atomic.Bool
+
+	mu          sync.Mutex
+	revertTimer *time.Timer
+	revertLevel Level
+	revertAt    time.Time
+
+	secretsMu sync.RWMutex
+	secrets   []string
+
+	sinksMu sync.RWMutex
+	sinks   []*sinkState
+
+	limiter limiter
 }
 
 func New(level Level, output io.Writer, uuid string) *Logger {
 	if output == nil {
 		output = os.Stdout
 	}
-	return &Logger{
-		level:  level,
+	l := &Logger{core: &core{
 		logger: log.New(output, "", 0),
+		output: output,
 		uuid:   redactUUID(uuid),
+	}}
+	l.level.Store(int32(level))
+	return l
+}
+
+// With returns a logger that adds the given key-value pairs to every entry,
+// e.g. With("component", "transport", "endpoint", url). Fields passed to a
+// log call take precedence over bound ones.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make(map[string]interface{}, len(l.fields)+len(keyvals)/2)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 < len(keyvals) {
+			fields[key] = keyvals[i+1]
+		} else {
+			fields[key] = nil
+		}
+	}
+	return &Logger{core: l.core, fields: fields}
+}
+
+// Level returns the current minimum level.
+func (l *Logger) Level() Level {
+	return Level(l.level.Load())
+}
+
+// SetLevel changes the minimum level and cancels any pending revert.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopRevert()
+	l.level.Store(int32(level))
+}
+
+// SetLevelFor changes the minimum level for d, then restores the level that
+// was in effect before the first of any overlapping temporary changes.
+func (l *Logger) SetLevelFor(level Level, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setLevelFor(level, d)
+}
+
+// StepLevel makes the level delta steps more verbose (negative) or less
+// verbose (positive), within DEBUG and ERROR, for d. Stepping back to the
+// level a temporary change would revert to cancels the revert.
+func (l *Logger) StepLevel(delta int, d time.Duration) Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	level := min(max(l.Level()+Level(delta), LevelDebug), LevelError)
+	if l.revertTimer != nil && level == l.revertLevel {
+		l.stopRevert()
+		l.level.Store(int32(level))
+	} else {
+		l.setLevelFor(level, d)
+	}
+	return level
+}
+
+// RevertLevel ends a temporary level change early.
+func (l *Logger) RevertLevel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.revertTimer == nil {
+		return
 	}
+	l.stopRevert()
+	l.level.Store(int32(l.revertLevel))
+}
+
+// TemporaryLevel reports the level a pending revert restores and when, or
+// ok false if the current level is not temporary.
+func (l *Logger) TemporaryLevel() (base Level, revertAt time.Time, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.revertTimer == nil {
+		return l.Level(), time.Time{}, false
+	}
+	return l.revertLevel, l.revertAt, true
+}
+
+func (l *Logger) stopRevert() {
+	if l.revertTimer != nil {
+		l.revertTimer.Stop()
+		l.revertTimer = nil
+	}
+}
+
+func (l *Logger) setLevelFor(level Level, d time.Duration) {
+	if l.revertTimer != nil {
+		l.revertTimer.Stop()
+	} else {
+		l.revertLevel = l.Level()
+	}
+	l.level.Store(int32(level))
+	l.revertAt = time.Now().Add(d)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.revertTimer != timer {
+			return
+		}
+		l.revertTimer = nil
+		l.level.Store(int32(l.revertLevel))
+	})
+	l.revertTimer = timer
 }
 
 func redactUUID(uuid string) string {
@@ -73,31 +235,54 @@ func redactUUID(uuid string) string {
 }
 
 func (l *Logger) log(level Level, msg string, fields map[string]interface{}) {
-	if level < l.level {
+	if level < l.Level() {
 		return
 	}
-
-	logEntry := map[string]interface{}{
-		"timestamp":     time.Now().UTC().Format(time.RFC3339),
-		"level":         level.String(),
-		"msg":           msg,
-		"gateway_uuid":  l.uuid,
-	}
-
-	for k, v := range fields {
-		if k == "token" || k == "authorization" {
-			continue
+	if len(l.fields) > 0 {
+		merged := make(map[string]interface{}, len(l.fields)+len(fields))
+		for k, v := range l.fields {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
 		}
-		logEntry[k] = v
+		fields = merged
 	}
-
-	jsonData, err := json.Marshal(logEntry)
-	if err != nil {
-		l.logger.Printf(`{"level":"ERROR","msg":"failed to marshal log entry","error":"%s"}`, err.Error())
+	if !l.allow(level, msg, fields) {
 		return
 	}
+	l.write(level, msg, fields, 0, "")
+}
+
+// write formats and writes an entry. suppressed and suppressedMsg are set
+// for rate limit summaries.
+func (l *Logger) write(level Level, msg string, fields map[string]interface{}, suppressed int, suppressedMsg string) {
+	now := time.Now()
+	msg = l.redactString(msg)
+	fields = l.redactFields(fields)
+	var line string
+	if Format(l.format.Load()) == FormatText {
+		line = l.formatText(now, level, msg, fields)
+	} else {
+		logEntry := map[string]interface{}{
+			"timestamp":    now.UTC().Format(time.RFC3339),
+			"level":        level.String(),
+			"msg":          msg,
+			"gateway_uuid": l.uuid,
+		}
+		for k, v := range fields {
+			logEntry[k] = v
+		}
+		jsonData, err := json.Marshal(logEntry)
+		if err != nil {
+			l.logger.Printf(`{"level":"ERROR","msg":"failed to marshal log entry","error":"%s"}`, err.Error())
+			return
+		}
+		line = string(jsonData)
+	}
 
-	l.logger.Println(string(jsonData))
+	l.logger.Println(l.redactSecrets(line))
+	l.writeSinks(now, level, msg, fields, suppressed, suppressedMsg)
 }
 
 func (l *Logger) Debug(msg string, fields map[string]interface{}) {
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStepLevel(t *testing.T) {
+	l := New(LevelWarn, io.Discard, "test-uuid")
+
+	if got := l.StepLevel(-1, time.Hour); got != LevelInfo {
+		t.Errorf("expected INFO after one step up, got %v", got)
+	}
+	if got := l.StepLevel(-5, time.Hour); got != LevelDebug {
+		t.Errorf("expected DEBUG as the most verbose level, got %v", got)
+	}
+	base, revertAt, ok := l.TemporaryLevel()
+	if !ok || base != LevelWarn || time.Until(revertAt) <= 0 {
+		t.Errorf("expected temporary level reverting to WARN, got %v %v %v", base, revertAt, ok)
+	}
+
+	// Stepping back down to the base level cancels the revert.
+	l.StepLevel(1, time.Hour)
+	l.StepLevel(1, time.Hour)
+	if _, _, ok := l.TemporaryLevel(); ok || l.Level() != LevelWarn {
+		t.Errorf("expected permanent WARN, got %v (temporary %v)", l.Level(), ok)
+	}
+
+	if got := l.StepLevel(5, time.Hour); got != LevelError {
+		t.Errorf("expected ERROR as the least verbose level, got %v", got)
+	}
+	l.RevertLevel()
+	if _, _, ok := l.TemporaryLevel(); ok || l.Level() != LevelWarn {
+		t.Errorf("expected WARN after RevertLevel, got %v", l.Level())
+	}
+}
+
+func TestSetLevelForReverts(t *testing.T) {
+	l := New(LevelInfo, io.Discard, "test-uuid")
+	l.SetLevelFor(LevelDebug, 20*time.Millisecond)
+	l.SetLevelFor(LevelWarn, 20*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Level() != LevelInfo {
+		if time.Now().After(deadline) {
+			t.Fatalf("level did not revert, still %v", l.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, _, ok := l.TemporaryLevel(); ok {
+		t.Error("expected no temporary level after revert")
+	}
+}
+
+func TestLevelTimeout(t *testing.T) {
+	for d, want := range map[time.Duration]time.Duration{
+		0:              DefaultLevelTimeout,
+		-time.Second:   DefaultLevelTimeout,
+		time.Minute:    time.Minute,
+		48 * time.Hour: MaxLevelTimeout,
+	} {
+		if got := LevelTimeout(d); got != want {
+			t.Errorf("LevelTimeout(%v) = %v, want %v", d, got, want)
+		}
+	}
+}
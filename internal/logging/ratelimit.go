@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit limits similar entries at one level: the first Burst in a
+// Window are logged, the rest are counted and reported in one summary
+// line when the window ends. A zero Window disables the limit.
+type RateLimit struct {
+	Window time.Duration
+	Burst  int
+}
+
+// Entries are similar when they have the same level, message, field names
+// and non-numeric field values, so a failure logged with an increasing
+// counter still counts as a repeat.
+type limiter struct {
+	mu     sync.Mutex
+	limits map[Level]RateLimit
+	states map[string]*limitState
+}
+
+type limitState struct {
+	count      int
+	suppressed int
+	fields     map[string]interface{}
+}
+
+// SetRateLimits replaces the limits per level. Windows already running
+// keep their length.
+func (l *Logger) SetRateLimits(limits map[Level]RateLimit) {
+	l.limiter.mu.Lock()
+	defer l.limiter.mu.Unlock()
+	l.limiter.limits = make(map[Level]RateLimit, len(limits))
+	for level, limit := range limits {
+		l.limiter.limits[level] = limit
+	}
+}
+
+// allow reports whether an entry should be logged, counting it against
+// its window if not.
+func (l *Logger) allow(level Level, msg string, fields map[string]interface{}) bool {
+	lim := &l.limiter
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	limit := lim.limits[level]
+	if limit.Window <= 0 {
+		return true
+	}
+
+	key := similarityKey(level, msg, fields)
+	if state, ok := lim.states[key]; ok {
+		state.count++
+		if state.count <= limit.Burst {
+			return true
+		}
+		state.suppressed++
+		state.fields = fields
+		return false
+	}
+
+	if lim.states == nil {
+		lim.states = make(map[string]*limitState)
+	}
+	lim.states[key] = &limitState{count: 1}
+	time.AfterFunc(limit.Window, func() {
+		l.endWindow(key, level, msg, limit.Window)
+	})
+	return true
+}
+
+func (l *Logger) endWindow(key string, level Level, msg string, window time.Duration) {
+	l.limiter.mu.Lock()
+	state := l.limiter.states[key]
+	delete(l.limiter.states, key)
+	l.limiter.mu.Unlock()
+	if state == nil || state.suppressed == 0 || level < l.Level() {
+		return
+	}
+
+	fields := make(map[string]interface{}, len(state.fields)+3)
+	for k, v := range state.fields {
+		fields[k] = v
+	}
+	fields["suppressed"] = state.suppressed
+	fields["suppressed_msg"] = msg
+	fields["window_seconds"] = int(window.Seconds())
+	l.write(level, fmt.Sprintf("Suppressed %d similar messages", state.suppressed), fields, state.suppressed, msg)
+}
+
+func similarityKey(level Level, msg string, fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(0)
+	b.WriteString(msg)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		if !isNumber(fields[k]) {
+			b.WriteString(formatValue(fields[k]))
+		}
+	}
+	return b.String()
+}
+
+func isNumber(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the summary written from a timer.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestRateLimitSuppressesSimilarEntries(t *testing.T) {
+	var out syncBuffer
+	l := New(LevelDebug, &out, "test-uuid")
+	recent := NewRecent(10)
+	l.AddSink(recent)
+	l.SetRateLimits(map[Level]RateLimit{
+		LevelError: {Window: 100 * time.Millisecond, Burst: 2},
+	})
+
+	for i := 1; i <= 5; i++ {
+		// The counter differs every time; the entries are still similar.
+		l.Error("Failed to send heartbeat", map[string]interface{}{
+			"error":                "connection refused",
+			"consecutive_failures": i,
+		})
+	}
+	l.Error("Failed to send heartbeat", map[string]interface{}{"error": "timeout"})
+	l.Warn("Not limited", nil)
+	l.Warn("Not limited", nil)
+
+	if got := len(out.lines(t)); got != 5 {
+		t.Fatalf("expected 2 + 1 errors and 2 warnings before the window ends, got %d", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(out.lines(t)) < 6 {
+		if time.Now().After(deadline) {
+			t.Fatal("no summary written at the end of the window")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lines := out.lines(t)
+	summary := lines[len(lines)-1]
+	if summary["msg"] != "Suppressed 3 similar messages" || summary["level"] != "ERROR" {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	if summary["suppressed_msg"] != "Failed to send heartbeat" || summary["consecutive_failures"] != float64(5) {
+		t.Errorf("expected summary with the latest fields, got %v", summary)
+	}
+
+	// The summary adds to the count of the summarised entry, which Recent
+	// folds by message alone.
+	entries, _ := recent.Since(0, 1<<20)
+	for _, e := range entries {
+		if e.Msg == "Failed to send heartbeat" && e.Count != 6 {
+			t.Errorf("expected count 6, got %+v", e)
+		}
+		if strings.HasPrefix(e.Msg, "Suppressed") {
+			t.Errorf("summary should not be kept as its own entry: %+v", e)
+		}
+	}
+
+	// A new window starts after the summary.
+	l.Error("Failed to send heartbeat", map[string]interface{}{"error": "connection refused"})
+	if got := len(out.lines(t)); got != 7 {
+		t.Errorf("expected the entry logged in a new window, got %d lines", got)
+	}
+}
+
+func TestSimilarityKey(t *testing.T) {
+	a := similarityKey(LevelError, "m", map[string]interface{}{"n": 1, "s": "x"})
+	b := similarityKey(LevelError, "m", map[string]interface{}{"n": 2.5, "s": "x"})
+	c := similarityKey(LevelError, "m", map[string]interface{}{"n": 1, "s": "y"})
+	d := similarityKey(LevelWarn, "m", map[string]interface{}{"n": 1, "s": "x"})
+	if a != b {
+		t.Error("numeric values should not affect similarity")
+	}
+	if a == c || a == d {
+		t.Error("string values and levels should affect similarity")
+	}
+}
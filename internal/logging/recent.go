@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// RecentEntry is a WARN or ERROR entry kept by Recent. Repeats with the same
+// level and message are folded into one entry that keeps the fields of the
+// latest occurrence.
+type RecentEntry struct {
+	// Seq increases every time the entry is logged again, so an entry with
+	// a higher count is reported anew.
+	Seq       uint64            `json:"seq"`
+	Level     string            `json:"level"`
+	Msg       string            `json:"msg"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Count     int               `json:"count"`
+	FirstSeen string            `json:"first_seen"`
+	LastSeen  string            `json:"last_seen"`
+	// FieldsDropped is set when the fields were left out to fit a size cap.
+	FieldsDropped bool `json:"fields_dropped,omitempty"`
+}
+
+// Recent is a Sink that keeps the last warnings and errors in memory, so
+// they can be reported without access to the gateway's logs.
+type Recent struct {
+	mu      sync.Mutex
+	max     int
+	seq     uint64
+	entries []*RecentEntry // oldest Seq first
+}
+
+// NewRecent keeps up to max distinct entries.
+func NewRecent(max int) *Recent {
+	return &Recent{max: max}
+}
+
+// WriteEntry implements Sink.
+func (r *Recent) WriteEntry(e *Entry) error {
+	if e.Level < LevelWarn {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A rate limit summary adds to the count of the entry it summarises.
+	msg, count, fields := e.Msg, 1, e.Fields
+	if e.Suppressed > 0 {
+		msg, count = e.SuppressedMsg, e.Suppressed
+		fields = make(map[string]string, len(e.Fields))
+		for k, v := range e.Fields {
+			if k != "suppressed" && k != "suppressed_msg" && k != "window_seconds" {
+				fields[k] = v
+			}
+		}
+	}
+
+	r.seq++
+	now := e.Time.UTC().Format(time.RFC3339)
+	level := e.Level.String()
+	for i, old := range r.entries {
+		if old.Level != level || old.Msg != msg {
+			continue
+		}
+		old.Seq = r.seq
+		old.Count += count
+		old.Fields = fields
+		old.LastSeen = now
+		r.entries = append(append(r.entries[:i], r.entries[i+1:]...), old)
+		return nil
+	}
+
+	r.entries = append(r.entries, &RecentEntry{
+		Seq:       r.seq,
+		Level:     level,
+		Msg:       msg,
+		Fields:    fields,
+		Count:     count,
+		FirstSeen: now,
+		LastSeen:  now,
+	})
+	if len(r.entries) > r.max {
+		r.entries = r.entries[len(r.entries)-r.max:]
+	}
+	return nil
+}
+
+// Since returns the entries logged after seq, oldest first, whose JSON
+// encoding fits in maxBytes, and the Seq of the last one returned (seq if
+// none). Entries that do not fit are left for the next call. An entry too
+// large on its own is returned without its fields.
+func (r *Recent) Since(seq uint64, maxBytes int) ([]RecentEntry, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []RecentEntry
+	size := 0
+	for _, e := range r.entries {
+		if e.Seq <= seq {
+			continue
+		}
+		entry := *e
+		n := encodedSize(&entry)
+		if n > maxBytes && len(out) == 0 {
+			entry.Fields = nil
+			entry.FieldsDropped = true
+			n = encodedSize(&entry)
+		}
+		if size+n > maxBytes && len(out) > 0 {
+			break
+		}
+		out = append(out, entry)
+		size += n
+		seq = entry.Seq
+	}
+	return out, seq
+}
+
+func encodedSize(e *RecentEntry) int {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0
+	}
+	// Allow for the separating comma.
+	return len(data) + 1
+}
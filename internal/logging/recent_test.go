@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRecentFoldsRepeatsAndEvicts(t *testing.T) {
+	recent := NewRecent(2)
+	l := New(LevelDebug, io.Discard, "test-uuid")
+	l.AddSink(recent)
+
+	l.Info("not kept", nil)
+	l.Warn("first", map[string]interface{}{"n": 1})
+	l.Error("second", nil)
+	l.Warn("first", map[string]interface{}{"n": 2})
+
+	entries, cursor := recent.Since(0, 1<<20)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if entries[0].Msg != "second" || entries[1].Msg != "first" {
+		t.Errorf("expected the repeated entry to move last, got %+v", entries)
+	}
+	if first := entries[1]; first.Count != 2 || first.Fields["n"] != "2" || first.Level != "WARN" {
+		t.Errorf("unexpected folded entry %+v", first)
+	}
+	if cursor != entries[1].Seq {
+		t.Errorf("expected cursor %d, got %d", entries[1].Seq, cursor)
+	}
+
+	// A third distinct entry evicts the oldest.
+	l.Error("third", nil)
+	entries, _ = recent.Since(0, 1<<20)
+	if len(entries) != 2 || entries[0].Msg != "first" || entries[1].Msg != "third" {
+		t.Errorf("expected first and third kept, got %+v", entries)
+	}
+	if entries, _ := recent.Since(cursor, 1<<20); len(entries) != 1 || entries[0].Msg != "third" {
+		t.Errorf("expected only the entry after the cursor, got %+v", entries)
+	}
+}
+
+func TestRecentSinceSizeCap(t *testing.T) {
+	recent := NewRecent(10)
+	l := New(LevelInfo, io.Discard, "test-uuid")
+	l.AddSink(recent)
+	l.Error("huge", map[string]interface{}{"body": strings.Repeat("x", 1000)})
+	l.Warn("a", nil)
+	l.Warn("b", nil)
+
+	entries, cursor := recent.Since(0, 200)
+	if len(entries) != 1 || !entries[0].FieldsDropped || entries[0].Fields != nil {
+		t.Fatalf("expected the oversized entry alone without fields, got %+v", entries)
+	}
+	entries, cursor = recent.Since(cursor, 200)
+	if len(entries) != 1 || entries[0].Msg != "a" {
+		t.Errorf("expected one entry to fit the cap, got %+v", entries)
+	}
+	entries, _ = recent.Since(cursor, 200)
+	if len(entries) != 1 || entries[0].Msg != "b" {
+		t.Errorf("expected the remaining entry next, got %+v", entries)
+	}
+}
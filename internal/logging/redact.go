@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Patterns for credentials embedded in free text, such as error strings
+// that echo a response body or a URL.
+var (
+	// key=value, key: value and "key":"value" for credential-like keys,
+	// including an optional Bearer/Basic scheme in the value.
+	keyValuePattern = regexp.MustCompile(`(?i)((?:access|refresh|id|api|client|session|auth)?[_-]?(?:token|password|passwd|secret|api[_-]?key|authorization|cookie)["']?\s*[:=]\s*["']?)(?:(?:bearer|basic)\s+)?[^\s"'&,;}\]]+`)
+	bearerPattern   = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]{8,}=*`)
+	userinfoPattern = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.\-]*://)[^/\s@]+@`)
+	jwtPattern      = regexp.MustCompile(`eyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]+`)
+	pemPattern      = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`)
+)
+
+// sensitiveKeyWords mark field names whose values are always masked, at
+// any depth. Names whose last word is a safeKeySuffix describe a credential
+// without revealing it, as token_fingerprint does, and are left alone; the
+// suffix only counts after a separator, so password_valid is still masked.
+var (
+	sensitiveKeyWords = []string{"token", "authorization", "password", "passwd", "secret", "apikey", "cookie", "credential", "privatekey"}
+	safeKeySuffixes   = []string{"fingerprint", "slot", "source", "file", "env", "command", "id"}
+)
+
+// Redact registers secret values that must never appear in log output.
+// Every occurrence in a log line is replaced with [REDACTED], whatever field
+// it appears in.
+func (l *Logger) Redact(values ...string) {
+	l.secretsMu.Lock()
+	defer l.secretsMu.Unlock()
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		known := false
+		for _, s := range l.secrets {
+			if s == v {
+				known = true
+				break
+			}
+		}
+		if !known {
+			l.secrets = append(l.secrets, v)
+		}
+	}
+}
+
+func (l *Logger) redactSecrets(line string) string {
+	l.secretsMu.RLock()
+	defer l.secretsMu.RUnlock()
+	for _, secret := range l.secrets {
+		line = strings.ReplaceAll(line, secret, "[REDACTED]")
+		// Secrets containing quotes or control characters appear escaped
+		// in the JSON line.
+		if escaped, err := json.Marshal(secret); err == nil {
+			if e := string(escaped[1 : len(escaped)-1]); e != secret {
+				line = strings.ReplaceAll(line, e, "[REDACTED]")
+			}
+		}
+	}
+	return line
+}
+
+// redactString masks credentials found by pattern and every registered
+// secret.
+func (l *Logger) redactString(s string) string {
+	s = pemPattern.ReplaceAllString(s, redacted)
+	s = userinfoPattern.ReplaceAllString(s, "${1}"+redacted+"@")
+	s = keyValuePattern.ReplaceAllString(s, "${1}"+redacted)
+	s = bearerPattern.ReplaceAllString(s, "${1} "+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return l.redactSecrets(s)
+}
+
+// redactFields returns a copy of fields with every value redacted.
+func (l *Logger) redactFields(fields map[string]interface{}) map[string]interface{} {
+	if fields == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if sensitiveKey(k) {
+			out[k] = redacted
+			continue
+		}
+		out[k] = l.redactValue(v)
+	}
+	return out
+}
+
+// redactValue walks v, redacting strings and masking values under
+// sensitive keys. Types other than the common ones are walked in their
+// JSON form, which is how they are logged.
+func (l *Logger) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool:
+		return v
+	case string:
+		return l.redactString(v)
+	case error:
+		return l.redactString(v.Error())
+	case map[string]interface{}:
+		return l.redactFields(v)
+	case map[string]string:
+		out := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			out[k] = s
+		}
+		return l.redactFields(out)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = l.redactValue(e)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, e := range v {
+			out[i] = l.redactString(e)
+		}
+		return out
+	}
+	if isNumber(v) {
+		return v
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return l.redactString(fmt.Sprint(v))
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return l.redactString(string(data))
+	}
+	return l.redactValue(generic)
+}
+
+func sensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	if i := strings.LastIndexAny(lower, "_-. "); i >= 0 && slices.Contains(safeKeySuffixes, lower[i+1:]) {
+		return false
+	}
+	normalized := strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(lower)
+	for _, word := range sensitiveKeyWords {
+		if strings.Contains(normalized, word) {
+			return true
+		}
+	}
+	return false
+}
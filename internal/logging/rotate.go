@@ -0,0 +1,273 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat names rotated files so they sort chronologically.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// RotateConfig configures a RotatingFile. Zero limits disable the
+// corresponding rotation trigger or retention cap.
+type RotateConfig struct {
+	Path string
+	// MaxSize rotates the file before a write would take it past this many
+	// bytes. Zero disables size-based rotation.
+	MaxSize int64
+	// MaxAge rotates the file once it has been written to for this long.
+	// Zero disables age-based rotation.
+	MaxAge time.Duration
+	// MaxFiles is how many rotated files are kept; older ones are deleted.
+	// Zero keeps them all.
+	MaxFiles int
+	// Compress gzips rotated files in the background.
+	Compress bool
+}
+
+// RotatingFile is an io.WriteCloser that appends to Path and renames it to
+// <name>-<timestamp><ext> when it grows too large or too old.
+type RotatingFile struct {
+	config RotateConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+
+	// Compression and pruning run on one background goroutine; rotations
+	// that happen meanwhile are folded into its next run.
+	pending chan struct{}
+	wg      sync.WaitGroup
+}
+
+// OpenRotatingFile opens or creates the log file, creating its directory
+// if needed, and tidies up rotated files left by earlier runs.
+func OpenRotatingFile(cfg RotateConfig) (*RotatingFile, error) {
+	f := &RotatingFile{
+		config:  cfg,
+		now:     time.Now,
+		pending: make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.wg.Add(1)
+	go f.maintainLoop()
+	f.scheduleMaintenance()
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	// The creation time is not portable; the last write is a fair bound for
+	// a file left by an earlier run.
+	if f.size > 0 && info.ModTime().Before(f.openedAt) {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		// A failed rotation left no file open; try again.
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the current file rather than losing lines.
+			fmt.Fprintf(os.Stderr, "failed to rotate log file: %v\n", err)
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.config.MaxSize > 0 && f.size+next > f.config.MaxSize {
+		return true
+	}
+	return f.config.MaxAge > 0 && f.now().Sub(f.openedAt) >= f.config.MaxAge
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := os.Rename(f.config.Path, f.rotatedName(f.now())); err != nil {
+		// Reopen the old file so writes can continue.
+		if oerr := f.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.scheduleMaintenance()
+	return nil
+}
+
+func (f *RotatingFile) rotatedName(t time.Time) string {
+	ext := filepath.Ext(f.config.Path)
+	base := strings.TrimSuffix(f.config.Path, ext)
+	return base + "-" + t.UTC().Format(rotatedTimeFormat) + ext
+}
+
+// rotatedFiles returns rotated files, compressed or not, oldest first.
+func (f *RotatingFile) rotatedFiles() ([]string, error) {
+	ext := filepath.Ext(f.config.Path)
+	base := strings.TrimSuffix(f.config.Path, ext)
+	matches, err := filepath.Glob(base + "-*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range matches {
+		stamp := strings.TrimPrefix(m, base+"-")
+		stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".gz"), ext)
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err == nil {
+			files = append(files, m)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (f *RotatingFile) scheduleMaintenance() {
+	select {
+	case f.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (f *RotatingFile) maintainLoop() {
+	defer f.wg.Done()
+	for range f.pending {
+		if err := f.maintain(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to clean up rotated log files: %v\n", err)
+		}
+	}
+}
+
+// maintain compresses rotated files and deletes all but the newest
+// MaxFiles of them.
+func (f *RotatingFile) maintain() error {
+	files, err := f.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	if f.config.MaxFiles > 0 && len(files) > f.config.MaxFiles {
+		for _, old := range files[:len(files)-f.config.MaxFiles] {
+			if err := os.Remove(old); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		files = files[len(files)-f.config.MaxFiles:]
+	}
+	if !f.config.Compress {
+		return nil
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, ".gz") {
+			continue
+		}
+		if err := gzipFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gzipFile replaces path with path.gz. The original is only removed once
+// the compressed copy is complete.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// Close closes the file and waits for background compression to finish.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if !f.closed {
+		f.closed = true
+		if f.file != nil {
+			err = f.file.Close()
+			f.file = nil
+		}
+		close(f.pending)
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+	f, err := OpenRotatingFile(RotateConfig{Path: path, MaxSize: 100, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	f.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 5; i++ {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != line {
+		t.Errorf("expected one line in the active file, got %q", current)
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "agent-*.log*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files kept, got %v", rotated)
+	}
+	for _, name := range rotated {
+		if !strings.HasSuffix(name, ".log.gz") {
+			t.Errorf("expected compressed rotated file, got %s", name)
+			continue
+		}
+		in, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			t.Fatalf("%s is not gzip: %v", name, err)
+		}
+		data, _ := io.ReadAll(zr)
+		in.Close()
+		if string(data) != line {
+			t.Errorf("unexpected content in %s: %q", name, data)
+		}
+	}
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+	if err := os.WriteFile(path, []byte("old run\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenRotatingFile(RotateConfig{Path: path, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	if _, err := f.Write([]byte("new run\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("still new\n")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "new run\nstill new\n" {
+		t.Errorf("expected stale file rotated before the first write, got %q", current)
+	}
+	rotated, _ := filepath.Glob(filepath.Join(dir, "agent-*.log"))
+	if len(rotated) != 1 {
+		t.Fatalf("expected 1 uncompressed rotated file, got %v", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "old run\n" {
+		t.Errorf("unexpected rotated content %q", data)
+	}
+}
+
+func TestRotatingFileWithLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "agent.log")
+	f, err := OpenRotatingFile(RotateConfig{Path: path})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	var stdout strings.Builder
+	logger := New(LevelInfo, io.MultiWriter(&stdout, f), "test-uuid")
+	logger.Info("hello", nil)
+	f.Close()
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"msg":"hello"`) || string(data) != stdout.String() {
+		t.Errorf("expected the same line in file and stdout, got %q and %q", data, stdout.String())
+	}
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Error("expected error writing after Close")
+	}
+}
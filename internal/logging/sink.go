@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives each entry that passes the level filter, in addition to the
+// JSON line written to the logger's output. Sinks must be safe for
+// concurrent use.
+type Sink interface {
+	WriteEntry(e *Entry) error
+}
+
+// Entry is a log entry as passed to a Sink. Field values are already
+// formatted as strings and redacted.
+type Entry struct {
+	Time   time.Time
+	Level  Level
+	Msg    string
+	UUID   string
+	Fields map[string]string
+	// Suppressed is set on a rate limit summary to the number of entries
+	// with message SuppressedMsg it stands for.
+	Suppressed    int
+	SuppressedMsg string
+}
+
+type sinkState struct {
+	sink    Sink
+	failing atomic.Bool
+}
+
+// AddSink adds a sink that receives every entry logged from now on.
+func (l *Logger) AddSink(s Sink) {
+	l.sinksMu.Lock()
+	defer l.sinksMu.Unlock()
+	l.sinks = append(l.sinks, &sinkState{sink: s})
+}
+
+// writeSinks passes an entry to every sink. msg and fields have already
+// been redacted by write.
+func (l *Logger) writeSinks(now time.Time, level Level, msg string, fields map[string]interface{}, suppressed int, suppressedMsg string) {
+	l.sinksMu.RLock()
+	sinks := l.sinks
+	l.sinksMu.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+
+	e := &Entry{
+		Time:   now,
+		Level:  level,
+		Msg:    msg,
+		UUID:   l.uuid,
+		Fields: make(map[string]string, len(fields)),
+
+		Suppressed:    suppressed,
+		SuppressedMsg: l.redactString(suppressedMsg),
+	}
+	for k, v := range fields {
+		e.Fields[k] = l.redactSecrets(formatValue(v))
+	}
+
+	for _, s := range sinks {
+		// Report a failing sink once, not on every line, and again only
+		// after it has recovered in between.
+		if err := s.sink.WriteEntry(e); err != nil {
+			if !s.failing.Swap(true) {
+				fmt.Fprintf(os.Stderr, "failed to write log entry to %T: %v\n", s.sink, err)
+			}
+		} else {
+			s.failing.Store(false)
+		}
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case error:
+		return v.Error()
+	}
+	if data, err := json.Marshal(v); err == nil {
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+// syslogSeverity maps l to a syslog severity, as used by journald's
+// PRIORITY field and RFC 5424.
+func (l Level) syslogSeverity() int {
+	switch l {
+	case LevelDebug:
+		return 7
+	case LevelInfo:
+		return 6
+	case LevelWarn:
+		return 4
+	default:
+		return 3
+	}
+}
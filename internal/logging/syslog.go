@@ -0,0 +1,236 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogSDID names the structured data element carrying the entry's
+// fields. 32473 is the private enterprise number RFC 5612 reserves for
+// documentation and examples.
+const syslogSDID = "gwagent@32473"
+
+const syslogDialTimeout = 5 * time.Second
+
+// Writes happen on the logging goroutine, so a stalled or missing relay must
+// not hold it up: each write and reconnect is bounded by syslogWriteTimeout,
+// and after a failed reconnect entries are dropped for syslogRedialBackoff.
+const (
+	syslogWriteTimeout  = time.Second
+	syslogRedialBackoff = 30 * time.Second
+)
+
+// errSyslogBackoff is returned for entries dropped while waiting to
+// reconnect.
+var errSyslogBackoff = errors.New("syslog relay unavailable, waiting to reconnect")
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseFacility returns the syslog facility code for a name such as
+// "daemon" or "local0".
+func ParseFacility(name string) (int, error) {
+	code, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return code, nil
+}
+
+// SyslogConfig configures a Syslog sink.
+type SyslogConfig struct {
+	// Network is udp, tcp or unix. A unix address may be a datagram or a
+	// stream socket.
+	Network  string
+	Address  string
+	Facility int
+	// Tag is the RFC 5424 APP-NAME.
+	Tag string
+}
+
+// Syslog sends entries as RFC 5424 messages to a local relay. TCP and unix
+// stream connections use octet-counting framing (RFC 6587).
+type Syslog struct {
+	config   SyslogConfig
+	hostname string
+	pid      string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	framed bool
+	// redialAt is when the next reconnect may be tried.
+	redialAt time.Time
+}
+
+// OpenSyslog connects to the relay. If the relay goes away later, a write
+// tries to reconnect once; if that fails, entries are dropped for a while
+// before the next try.
+func OpenSyslog(cfg SyslogConfig) (*Syslog, error) {
+	switch cfg.Network {
+	case "udp", "tcp", "unix":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", cfg.Network)
+	}
+	hostname, _ := os.Hostname()
+	s := &Syslog{
+		config:   cfg,
+		hostname: syslogToken(hostname, 255),
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+	if err := s.dial(syslogDialTimeout); err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Syslog) dial(timeout time.Duration) error {
+	network := s.config.Network
+	if network == "unix" {
+		// /dev/log is usually a datagram socket, but some relays listen
+		// on a stream socket.
+		conn, err := net.DialTimeout("unixgram", s.config.Address, timeout)
+		if err == nil {
+			s.conn, s.framed = conn, false
+			return nil
+		}
+	}
+	conn, err := net.DialTimeout(network, s.config.Address, timeout)
+	if err != nil {
+		return err
+	}
+	s.conn, s.framed = conn, network != "udp"
+	return nil
+}
+
+// WriteEntry implements Sink.
+func (s *Syslog) WriteEntry(e *Entry) error {
+	msg := s.format(e)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if time.Now().Before(s.redialAt) {
+				return errSyslogBackoff
+			}
+			if err = s.dial(syslogWriteTimeout); err != nil {
+				s.redialAt = time.Now().Add(syslogRedialBackoff)
+				return err
+			}
+		}
+		data := msg
+		if s.framed {
+			data = strconv.Itoa(len(msg)) + " " + msg
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err = s.conn.Write([]byte(data)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// format renders e as an RFC 5424 message.
+func (s *Syslog) format(e *Entry) string {
+	var b strings.Builder
+	pri := s.config.Facility*8 + e.Level.syslogSeverity()
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ",
+		pri,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		nilValue(s.hostname),
+		nilValue(syslogToken(s.config.Tag, 48)),
+		s.pid,
+	)
+
+	b.WriteString("[" + syslogSDID)
+	writeSDParam(&b, "level", e.Level.String())
+	writeSDParam(&b, "gateway_uuid", e.UUID)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := sdParamName(k); name != "" {
+			writeSDParam(&b, name, e.Fields[k])
+		}
+	}
+	b.WriteString("] ")
+
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Close implements io.Closer.
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func writeSDParam(b *strings.Builder, name, value string) {
+	b.WriteString(" " + name + `="`)
+	for _, r := range value {
+		if r == '"' || r == '\\' || r == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+}
+
+// sdParamName drops the characters RFC 5424 forbids in a PARAM-NAME.
+func sdParamName(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if r > 32 && r < 127 && r != '=' && r != ']' && r != '"' {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	if name == "level" || name == "gateway_uuid" {
+		return ""
+	}
+	return name
+}
+
+// syslogToken keeps the printable ASCII characters of s, up to max of them,
+// as RFC 5424 requires for header fields.
+func syslogToken(s string, max int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > 32 && r < 127 && b.Len() < max {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	s := &Syslog{
+		config:   SyslogConfig{Facility: 3, Tag: "gw agent"},
+		hostname: "gw-01",
+		pid:      "42",
+	}
+	e := &Entry{
+		Time:  time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC),
+		Level: LevelWarn,
+		Msg:   "Heartbeat failed",
+		UUID:  "abcd...wxyz",
+		Fields: map[string]string{
+			"error":                `status 503 "unavailable" [retry]`,
+			"consecutive_failures": "3",
+		},
+	}
+	want := `<28>1 2026-01-02T03:04:05.000006Z gw-01 gwagent 42 - ` +
+		`[gwagent@32473 level="WARN" gateway_uuid="abcd...wxyz" consecutive_failures="3" error="status 503 \"unavailable\" [retry\]"] ` +
+		`Heartbeat failed`
+	if got := s.format(e); got != want {
+		t.Errorf("unexpected message\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink, err := OpenSyslog(SyslogConfig{Network: "udp", Address: pc.LocalAddr().String(), Facility: 16, Tag: "gw-agent"})
+	if err != nil {
+		t.Fatalf("OpenSyslog failed: %v", err)
+	}
+	defer sink.Close()
+
+	logger := New(LevelInfo, io.Discard, "gateway-uuid-1234")
+	logger.AddSink(sink)
+	logger.Redact("s3cret")
+	logger.Debug("not sent", nil)
+	logger.Error("Request failed", map[string]interface{}{"error": "token s3cret rejected", "attempt": 2})
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no datagram received: %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<131>1 ") {
+		t.Errorf("expected local0.err priority, got %q", msg)
+	}
+	for _, want := range []string{` gw-agent `, `gateway_uuid="gate...1234"`, `attempt="2"`, `error="token [REDACTED\] rejected"`, `] Request failed`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in %q", want, msg)
+		}
+	}
+}
+
+func TestSyslogTCPFramingAndReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			length, err := r.ReadString(' ')
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			io.ReadFull(r, msg)
+			received <- string(msg)
+			// Drop the connection after each message to force a reconnect.
+			conn.Close()
+		}
+	}()
+
+	sink, err := OpenSyslog(SyslogConfig{Network: "tcp", Address: ln.Addr().String(), Facility: 3, Tag: "gw-agent"})
+	if err != nil {
+		t.Fatalf("OpenSyslog failed: %v", err)
+	}
+	defer sink.Close()
+
+	e := &Entry{Time: time.Now(), Level: LevelInfo, Msg: "first"}
+	if err := sink.WriteEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; !strings.HasSuffix(got, "] first") {
+		t.Errorf("unexpected first message %q", got)
+	}
+
+	// The first write after the server closed the connection may succeed
+	// locally and be lost; keep writing until one arrives on a new
+	// connection.
+	deadline := time.After(5 * time.Second)
+	for {
+		e.Msg = "second"
+		sink.WriteEntry(e)
+		select {
+		case got := <-received:
+			if !strings.HasSuffix(got, "] second") {
+				t.Errorf("unexpected message after reconnect %q", got)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no message received after reconnect")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestSyslogBacksOffAfterFailedReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := OpenSyslog(SyslogConfig{Network: "tcp", Address: ln.Addr().String(), Facility: 3, Tag: "gw-agent"})
+	if err != nil {
+		t.Fatalf("OpenSyslog failed: %v", err)
+	}
+	defer sink.Close()
+
+	// The relay goes away and the connection is found broken.
+	ln.Close()
+	sink.Close()
+
+	e := &Entry{Time: time.Now(), Level: LevelInfo, Msg: "lost"}
+	if err := sink.WriteEntry(e); err == nil || errors.Is(err, errSyslogBackoff) {
+		t.Fatalf("expected reconnect error, got %v", err)
+	}
+	if err := sink.WriteEntry(e); !errors.Is(err, errSyslogBackoff) {
+		t.Errorf("expected entries to be dropped until the backoff ends, got %v", err)
+	}
+}
+
+func TestOpenSyslogErrors(t *testing.T) {
+	if _, err := OpenSyslog(SyslogConfig{Network: "smtp", Address: "localhost:25"}); err == nil {
+		t.Error("expected error for unsupported network")
+	}
+	if _, err := ParseFacility("local9"); err == nil {
+		t.Error("expected error for unknown facility")
+	}
+	if code, err := ParseFacility("DAEMON"); err != nil || code != 3 {
+		t.Errorf("ParseFacility(DAEMON) = %d, %v", code, err)
+	}
+}
@@ -0,0 +1,177 @@
+package platform
+
+import "strings"
+
+const (
+	HypervisorKVM        = "kvm"
+	HypervisorVMware     = "vmware"
+	HypervisorHyperV     = "hyperv"
+	HypervisorXen        = "xen"
+	HypervisorVirtualBox = "virtualbox"
+	// HypervisorOther is reported when the CPU reports a hypervisor that
+	// could not be identified.
+	HypervisorOther = "other"
+)
+
+const (
+	ContainerDocker     = "docker"
+	ContainerPodman     = "podman"
+	ContainerLXC        = "lxc"
+	ContainerKubernetes = "kubernetes"
+	// ContainerOther is reported for runtimes that only identify
+	// themselves through the "container" environment variable.
+	ContainerOther = "other"
+)
+
+const (
+	CloudAWS   = "aws"
+	CloudGCP   = "gcp"
+	CloudAzure = "azure"
+)
+
+// azureAssetTag is the DMI chassis asset tag Azure sets on every VM.
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// dmiFiles are the DMI fields used to identify hypervisors and clouds.
+var dmiFiles = []string{
+	"sys_vendor",
+	"product_name",
+	"product_version",
+	"bios_vendor",
+	"bios_version",
+	"board_vendor",
+	"chassis_vendor",
+}
+
+func (d detector) detectEnvironment(info *Info) {
+	switch d.goos {
+	case "linux":
+		info.WSL = d.isWSL()
+		info.Container = d.container()
+		info.Cloud = d.cloud()
+		info.Hypervisor = d.hypervisor(info.WSL)
+	case "windows":
+		if d.exists(`Windows\System32\drivers\vmmouse.sys`) || d.exists(`Windows\System32\drivers\vmhgfs.sys`) {
+			info.Hypervisor = HypervisorVMware
+		}
+	}
+	info.Virtualization = info.Hypervisor != ""
+}
+
+// dmi returns the DMI identification fields joined into one lowercased
+// string.
+func (d detector) dmi() string {
+	var b strings.Builder
+	for _, name := range dmiFiles {
+		b.WriteString(d.read("sys/class/dmi/id/" + name))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (d detector) hypervisor(wsl bool) string {
+	dmi := d.dmi()
+	switch {
+	case strings.Contains(dmi, "vmware"):
+		return HypervisorVMware
+	case strings.Contains(dmi, "virtualbox"), strings.Contains(dmi, "innotek"):
+		return HypervisorVirtualBox
+	case strings.Contains(dmi, "xen"), d.read("sys/hypervisor/type") == "xen":
+		return HypervisorXen
+	case strings.Contains(dmi, "kvm"), strings.Contains(dmi, "qemu"):
+		return HypervisorKVM
+	case strings.Contains(dmi, "microsoft corporation") && strings.Contains(dmi, "virtual machine"):
+		return HypervisorHyperV
+	}
+
+	if !hasCPUFlag(d.read("proc/cpuinfo"), "hypervisor") {
+		return ""
+	}
+	// EC2 Nitro and Compute Engine VMs run on KVM; their bare-metal
+	// instances have the same DMI vendor but no hypervisor flag.
+	if strings.Contains(dmi, "amazon ec2") || strings.Contains(dmi, "google compute engine") {
+		return HypervisorKVM
+	}
+	// WSL 2 runs in a Hyper-V utility VM that has no DMI tables.
+	if wsl {
+		return HypervisorHyperV
+	}
+	return HypervisorOther
+}
+
+// hasCPUFlag reports whether any "flags" line of cpuinfo lists flag.
+func hasCPUFlag(cpuinfo, flag string) bool {
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) != "flags" {
+			continue
+		}
+		for _, f := range strings.Fields(value) {
+			if f == flag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d detector) cloud() string {
+	dmi := d.dmi()
+	switch {
+	// Xen-based EC2 instances only mention Amazon in bios_version.
+	case strings.Contains(dmi, "amazon"):
+		return CloudAWS
+	// Chromebooks also have Google as their vendor.
+	case strings.Contains(dmi, "google compute engine"):
+		return CloudGCP
+	case d.read("sys/class/dmi/id/chassis_asset_tag") == azureAssetTag:
+		return CloudAzure
+	}
+	return ""
+}
+
+func (d detector) isWSL() bool {
+	if d.getenv("WSL_DISTRO_NAME") != "" || d.getenv("WSL_INTEROP") != "" {
+		return true
+	}
+	return strings.Contains(d.read("proc/sys/kernel/osrelease"), "microsoft") ||
+		d.exists("proc/sys/fs/binfmt_misc/WSLInterop")
+}
+
+// container identifies the container runtime from marker files, cgroup
+// paths and the environment. The process environment is checked as well
+// as PID 1's, which is only readable as root.
+func (d detector) container() string {
+	cgroups := d.read("proc/self/cgroup") + "\n" + d.read("proc/1/cgroup")
+	env := d.getenv("container")
+	if env == "" {
+		env = environValue(d.read("proc/1/environ"), "container")
+	}
+
+	switch {
+	case d.getenv("KUBERNETES_SERVICE_HOST") != "",
+		d.exists("var/run/secrets/kubernetes.io/serviceaccount"),
+		strings.Contains(cgroups, "kubepods"):
+		return ContainerKubernetes
+	case env == "podman", d.exists("run/.containerenv"), strings.Contains(cgroups, "libpod"):
+		return ContainerPodman
+	case env == "docker", d.exists(".dockerenv"), strings.Contains(cgroups, "/docker/"), strings.Contains(cgroups, "/docker-"),
+		strings.Contains(d.read("proc/self/mountinfo"), "/docker/containers/"):
+		return ContainerDocker
+	case env == "lxc", env == "lxc-libvirt", strings.Contains(cgroups, "/lxc/"), strings.Contains(cgroups, "/lxc.payload"):
+		return ContainerLXC
+	case env != "":
+		return ContainerOther
+	}
+	return ""
+}
+
+// environValue returns the value of key in a NUL-separated environ file.
+func environValue(environ, key string) string {
+	for _, kv := range strings.Split(environ, "\x00") {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
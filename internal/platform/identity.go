@@ -0,0 +1,196 @@
+package platform
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Identity describes the operating system and hardware. Fields that could
+// not be read are empty.
+type Identity struct {
+	// OSID, OSVersionID, OSPrettyName and OSIDLike are ID, VERSION_ID,
+	// PRETTY_NAME and ID_LIKE from os-release.
+	OSID         string   `json:"os_id,omitempty"`
+	OSVersionID  string   `json:"os_version_id,omitempty"`
+	OSPrettyName string   `json:"os_pretty_name,omitempty"`
+	OSIDLike     []string `json:"os_id_like,omitempty"`
+	Kernel       string   `json:"kernel,omitempty"`
+	Hostname     string   `json:"hostname,omitempty"`
+	MachineID    string   `json:"machine_id,omitempty"`
+	Vendor       string   `json:"vendor,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Serial       string   `json:"serial,omitempty"`
+	// PiRevision is the Raspberry Pi revision code in hex, e.g. "c03114".
+	PiRevision string `json:"pi_revision,omitempty"`
+}
+
+// IsRaspberryPi reports whether the board model is a Raspberry Pi.
+func (i Identity) IsRaspberryPi() bool {
+	return strings.Contains(strings.ToLower(i.Model), "raspberry pi")
+}
+
+// ReadIdentity reads the identity of the running host. It is cheap enough
+// to call on every heartbeat to notice changes such as an OS upgrade or a
+// new hostname.
+func ReadIdentity() Identity {
+	return defaultDetector().identity()
+}
+
+// dmiPlaceholders are values firmware vendors leave in unset DMI fields.
+var dmiPlaceholders = []string{
+	"",
+	"0",
+	"none",
+	"default string",
+	"not specified",
+	"not applicable",
+	"to be filled by o.e.m.",
+	"system product name",
+	"system serial number",
+	"system manufacturer",
+	"0123456789",
+}
+
+func (d detector) identity() Identity {
+	var id Identity
+	if d.goos != "linux" {
+		id.Hostname, _ = os.Hostname()
+		return id
+	}
+
+	release := d.osRelease()
+	id.OSID = release["ID"]
+	id.OSVersionID = release["VERSION_ID"]
+	id.OSPrettyName = release["PRETTY_NAME"]
+	id.OSIDLike = strings.Fields(release["ID_LIKE"])
+	id.Kernel = d.readValue("proc/sys/kernel/osrelease")
+	id.Hostname = d.readValue("proc/sys/kernel/hostname")
+	id.MachineID = d.readValue("etc/machine-id")
+	if id.MachineID == "" {
+		id.MachineID = d.readValue("var/lib/dbus/machine-id")
+	}
+
+	cpuinfo := cpuinfoFields(d.readValue("proc/cpuinfo"))
+	id.Model = d.deviceTree("model")
+	if id.Model == "" {
+		// ARM kernels also report the board model in cpuinfo.
+		id.Model = cpuinfo["Model"]
+	}
+	if id.Model != "" {
+		id.Serial = d.deviceTree("serial-number")
+		if id.Serial == "" {
+			id.Serial = cpuinfo["Serial"]
+		}
+		if id.IsRaspberryPi() {
+			id.PiRevision = d.piRevision(cpuinfo)
+		}
+		return id
+	}
+
+	id.Vendor = d.dmiValue("sys_vendor")
+	id.Model = d.dmiValue("product_name")
+	if id.Model == "" {
+		id.Model = d.dmiValue("board_name")
+	}
+	// product_serial and board_serial are only readable by root.
+	id.Serial = d.dmiValue("product_serial")
+	if id.Serial == "" {
+		id.Serial = d.dmiValue("board_serial")
+	}
+	return id
+}
+
+// osRelease parses /etc/os-release, falling back to /usr/lib/os-release
+// as os-release(5) specifies.
+func (d detector) osRelease() map[string]string {
+	data := d.readValue("etc/os-release")
+	if data == "" {
+		data = d.readValue("usr/lib/os-release")
+	}
+	return parseOSRelease(data)
+}
+
+// parseOSRelease parses the shell-style KEY=value assignments of an
+// os-release file.
+func parseOSRelease(data string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[key] = unquoteShell(value)
+	}
+	return values
+}
+
+func unquoteShell(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '\'' {
+			return s[1 : len(s)-1]
+		}
+		s = s[1 : len(s)-1]
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// cpuinfoFields returns the "Key : value" lines of cpuinfo. Keys repeated
+// per processor keep their last value; the board-wide Revision, Serial and
+// Model lines come last on ARM.
+func cpuinfoFields(cpuinfo string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// deviceTree reads a device tree property from /proc/device-tree, or from
+// /sys/firmware/devicetree/base where /proc/device-tree is missing.
+func (d detector) deviceTree(name string) string {
+	if v := d.readValue("proc/device-tree/" + name); v != "" {
+		return v
+	}
+	return d.readValue("sys/firmware/devicetree/base/" + name)
+}
+
+func (d detector) dmiValue(name string) string {
+	v := d.readValue("sys/class/dmi/id/" + name)
+	if slices.Contains(dmiPlaceholders, strings.ToLower(v)) {
+		return ""
+	}
+	return v
+}
+
+// piRevision returns the revision code from cpuinfo, or from the
+// big-endian linux,revision device tree property on kernels whose cpuinfo
+// no longer has a Revision line.
+func (d detector) piRevision(cpuinfo map[string]string) string {
+	if rev := cpuinfo["Revision"]; rev != "" {
+		return strings.ToLower(rev)
+	}
+	for _, name := range []string{"proc/device-tree/system/linux,revision", "sys/firmware/devicetree/base/system/linux,revision"} {
+		data, err := os.ReadFile(d.path(name))
+		if err == nil && len(data) == 4 {
+			return fmt.Sprintf("%04x", binary.BigEndian.Uint32(data))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/binary-gws/agent/internal/testutil"
+)
+
+func TestIdentityFromDMI(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{
+		"etc/os-release": `PRETTY_NAME="Ubuntu 22.04.4 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+ID=ubuntu
+ID_LIKE=debian
+`,
+		"proc/sys/kernel/osrelease":       "5.15.0-105-generic\n",
+		"proc/sys/kernel/hostname":        "gw-01\n",
+		"etc/machine-id":                  "4c4c4544004a3510804cb4c04f4e3332\n",
+		"sys/class/dmi/id/sys_vendor":     "Dell Inc.\n",
+		"sys/class/dmi/id/product_name":   "OptiPlex 7090\n",
+		"sys/class/dmi/id/product_serial": "To Be Filled By O.E.M.\n",
+		"sys/class/dmi/id/board_serial":   ".7XJ5Q33.CNFCW0013.\n",
+	})
+
+	info := testDetector(root, nil).detect("")
+	want := Identity{
+		OSID:         "ubuntu",
+		OSVersionID:  "22.04",
+		OSPrettyName: "Ubuntu 22.04.4 LTS",
+		OSIDLike:     []string{"debian"},
+		Kernel:       "5.15.0-105-generic",
+		Hostname:     "gw-01",
+		MachineID:    "4c4c4544004a3510804cb4c04f4e3332",
+		Vendor:       "Dell Inc.",
+		Model:        "OptiPlex 7090",
+		Serial:       ".7XJ5Q33.CNFCW0013.",
+	}
+	if !reflect.DeepEqual(info.Identity, want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, info.Identity)
+	}
+	if info.Platform != PlatformUbuntu {
+		t.Errorf("expected ubuntu, got %q", info.Platform)
+	}
+}
+
+func TestIdentityFromDeviceTree(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{
+		"usr/lib/os-release":          "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\n",
+		"var/lib/dbus/machine-id":     "9a1f3c\n",
+		"proc/device-tree/model":      "Raspberry Pi 4 Model B Rev 1.4\x00",
+		"proc/cpuinfo":                "processor\t: 0\nBogoMIPS\t: 108.00\n\nRevision\t: C03114\nSerial\t\t: 10000000a3b2c1d0\nModel\t\t: Raspberry Pi 4 Model B Rev 1.4\n",
+		"sys/class/dmi/id/sys_vendor": "ignored\n",
+	})
+
+	id := testDetector(root, nil).identity()
+	if id.OSID != "debian" || id.OSVersionID != "12" || id.OSPrettyName != "Debian GNU/Linux 12 (bookworm)" {
+		t.Errorf("expected Debian 12 from /usr/lib/os-release, got %+v", id)
+	}
+	if id.MachineID != "9a1f3c" {
+		t.Errorf("expected D-Bus machine ID, got %q", id.MachineID)
+	}
+	if id.Model != "Raspberry Pi 4 Model B Rev 1.4" || id.Vendor != "" {
+		t.Errorf("expected device tree model only, got %q %q", id.Vendor, id.Model)
+	}
+	if id.Serial != "10000000a3b2c1d0" || id.PiRevision != "c03114" {
+		t.Errorf("expected serial and revision from cpuinfo, got %q %q", id.Serial, id.PiRevision)
+	}
+}
+
+func TestPiRevisionFromDeviceTree(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{
+		"sys/firmware/devicetree/base/model":                 "Raspberry Pi 5 Model B Rev 1.0\x00",
+		"sys/firmware/devicetree/base/serial-number":         "6c2a3b4d5e6f7081\x00",
+		"sys/firmware/devicetree/base/system/linux,revision": "\x00\xd0\x40\x17",
+	})
+
+	id := testDetector(root, nil).identity()
+	if id.PiRevision != "d04017" || id.Serial != "6c2a3b4d5e6f7081" {
+		t.Errorf("expected revision and serial from the device tree, got %q %q", id.PiRevision, id.Serial)
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	values := parseOSRelease(`# comment
+NAME='Linux Mint'
+PRETTY_NAME="Linux \"Mint\" 21.3"
+ID=linuxmint
+ID_LIKE="ubuntu debian"
+`)
+	if values["NAME"] != "Linux Mint" || values["PRETTY_NAME"] != `Linux "Mint" 21.3` || values["ID_LIKE"] != "ubuntu debian" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestUbuntuDerivativeIsUbuntu(t *testing.T) {
+	for release, want := range map[string]string{
+		"ID=linuxmint\nID_LIKE=\"ubuntu debian\"\n": PlatformUbuntu,
+		"ID=debian\n": PlatformLinux,
+		// The old substring match took this for Ubuntu.
+		"ID=debian\nHOME_URL=\"https://example.com/not-ubuntu\"\n": PlatformLinux,
+	} {
+		info := testDetector(testutil.FixtureRoot(t, map[string]string{"etc/os-release": release}), nil).detect("")
+		if info.Platform != want {
+			t.Errorf("%q: expected %q, got %q", release, want, info.Platform)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package platform
 
 import (
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 )
 
@@ -19,24 +21,84 @@ type Info struct {
 	OS             string
 	Arch           string
 	Virtualization bool
+
+	// Hypervisor is one of the Hypervisor constants when running in a
+	// virtual machine, and empty otherwise.
+	Hypervisor string
+	// Container is one of the Container constants when running in a
+	// container, and empty otherwise.
+	Container string
+	// WSL is set under the Windows Subsystem for Linux.
+	WSL bool
+	// Cloud is one of the Cloud constants when DMI identifies the host as
+	// a cloud instance.
+	Cloud string
+
+	Identity Identity
+}
+
+// detector reads system files relative to root, so that detection can be
+// tested against a fixture tree instead of the real /proc and /sys.
+type detector struct {
+	root   string
+	goos   string
+	goarch string
+	getenv func(string) string
+}
+
+func (d detector) path(name string) string {
+	return filepath.Join(d.root, filepath.FromSlash(name))
+}
+
+// readValue returns the contents of name with surrounding whitespace and
+// NULs trimmed, or "" if it cannot be read.
+func (d detector) readValue(name string) string {
+	data, err := os.ReadFile(d.path(name))
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(string(data), " \t\r\n\x00")
+}
+
+// read is readValue lowercased, for matching.
+func (d detector) read(name string) string {
+	return strings.ToLower(d.readValue(name))
+}
+
+func (d detector) exists(name string) bool {
+	_, err := os.Stat(d.path(name))
+	return err == nil
 }
 
 func Detect(override string) *Info {
-	if override != "" {
-		return &Info{
-			Platform:       override,
-			OS:             runtime.GOOS,
-			Arch:           runtime.GOARCH,
-			Virtualization: false,
-		}
+	return defaultDetector().detect(override)
+}
+
+func defaultDetector() detector {
+	root := "/"
+	if runtime.GOOS == "windows" {
+		root = `C:\`
+	}
+	return detector{
+		root:   root,
+		goos:   runtime.GOOS,
+		goarch: runtime.GOARCH,
+		getenv: os.Getenv,
 	}
+}
 
+func (d detector) detect(override string) *Info {
 	info := &Info{
-		OS:   runtime.GOOS,
-		Arch: runtime.GOARCH,
+		OS:       d.goos,
+		Arch:     d.goarch,
+		Identity: d.identity(),
 	}
+	d.detectEnvironment(info)
 
-	info.Virtualization = detectVirtualization()
+	if override != "" {
+		info.Platform = override
+		return info
+	}
 
 	if info.Virtualization {
 		info.Platform = PlatformVM
@@ -47,9 +109,9 @@ func Detect(override string) *Info {
 	case "windows":
 		info.Platform = PlatformWindows
 	case "linux":
-		if info.Arch == "arm64" && isRaspberryPi() {
+		if (info.Arch == "arm64" || info.Arch == "arm") && info.Identity.IsRaspberryPi() {
 			info.Platform = PlatformRaspberryPi
-		} else if isUbuntu() {
+		} else if info.Identity.OSID == "ubuntu" || slices.Contains(info.Identity.OSIDLike, "ubuntu") {
 			info.Platform = PlatformUbuntu
 		} else {
 			info.Platform = PlatformLinux
@@ -60,72 +122,3 @@ func Detect(override string) *Info {
 
 	return info
 }
-
-func detectVirtualization() bool {
-	if runtime.GOOS == "linux" {
-		data, err := os.ReadFile("/sys/class/dmi/id/product_name")
-		if err == nil {
-			product := strings.ToLower(string(data))
-			if strings.Contains(product, "virtualbox") ||
-				strings.Contains(product, "vmware") ||
-				strings.Contains(product, "kvm") ||
-				strings.Contains(product, "qemu") ||
-				strings.Contains(product, "virtual") {
-				return true
-			}
-		}
-
-		data, err = os.ReadFile("/proc/cpuinfo")
-		if err == nil {
-			cpuinfo := strings.ToLower(string(data))
-			if strings.Contains(cpuinfo, "hypervisor") {
-				return true
-			}
-		}
-	}
-
-	if runtime.GOOS == "windows" {
-		data, err := os.ReadFile("C:\\Windows\\System32\\drivers\\vmmouse.sys")
-		if err == nil && len(data) > 0 {
-			return true
-		}
-		data, err = os.ReadFile("C:\\Windows\\System32\\drivers\\vmhgfs.sys")
-		if err == nil && len(data) > 0 {
-			return true
-		}
-	}
-
-	return false
-}
-
-func isRaspberryPi() bool {
-	data, err := os.ReadFile("/proc/device-tree/model")
-	if err == nil {
-		model := strings.ToLower(string(data))
-		if strings.Contains(model, "raspberry") {
-			return true
-		}
-	}
-
-	data, err = os.ReadFile("/sys/firmware/devicetree/base/model")
-	if err == nil {
-		model := strings.ToLower(string(data))
-		if strings.Contains(model, "raspberry") {
-			return true
-		}
-	}
-
-	return false
-}
-
-func isUbuntu() bool {
-	data, err := os.ReadFile("/etc/os-release")
-	if err == nil {
-		osRelease := strings.ToLower(string(data))
-		if strings.Contains(osRelease, "ubuntu") {
-			return true
-		}
-	}
-
-	return false
-}
@@ -0,0 +1,252 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/binary-gws/agent/internal/testutil"
+)
+
+func testDetector(root string, env map[string]string) detector {
+	return detector{
+		root:   root,
+		goos:   "linux",
+		goarch: "amd64",
+		getenv: func(key string) string { return env[key] },
+	}
+}
+
+const cpuinfoHypervisor = "processor\t: 0\nflags\t\t: fpu vme de pse hypervisor\n"
+
+func TestDetectEnvironment(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		env        map[string]string
+		hypervisor string
+		container  string
+		cloud      string
+		wsl        bool
+		platform   string
+	}{
+		{
+			name:     "bare metal",
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "Dell Inc.\n", "proc/cpuinfo": "flags\t\t: fpu vme\n"},
+			platform: PlatformLinux,
+		},
+		{
+			name: "vmware",
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor":   "VMware, Inc.\n",
+				"sys/class/dmi/id/product_name": "VMware Virtual Platform\n",
+				"proc/cpuinfo":                  cpuinfoHypervisor,
+			},
+			hypervisor: HypervisorVMware,
+			platform:   PlatformVM,
+		},
+		{
+			name:       "virtualbox",
+			files:      map[string]string{"sys/class/dmi/id/sys_vendor": "innotek GmbH\n", "sys/class/dmi/id/product_name": "VirtualBox\n"},
+			hypervisor: HypervisorVirtualBox,
+			platform:   PlatformVM,
+		},
+		{
+			name:       "proxmox",
+			files:      map[string]string{"sys/class/dmi/id/sys_vendor": "QEMU\n", "sys/class/dmi/id/product_name": "Standard PC (Q35 + ICH9, 2009)\n"},
+			hypervisor: HypervisorKVM,
+			platform:   PlatformVM,
+		},
+		{
+			name:       "hyper-v",
+			files:      map[string]string{"sys/class/dmi/id/sys_vendor": "Microsoft Corporation\n", "sys/class/dmi/id/product_name": "Virtual Machine\n"},
+			hypervisor: HypervisorHyperV,
+			platform:   PlatformVM,
+		},
+		{
+			name: "azure",
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor":        "Microsoft Corporation\n",
+				"sys/class/dmi/id/product_name":      "Virtual Machine\n",
+				"sys/class/dmi/id/chassis_asset_tag": "7783-7084-3265-9085-8269-3286-77\n",
+			},
+			hypervisor: HypervisorHyperV,
+			cloud:      CloudAzure,
+			platform:   PlatformVM,
+		},
+		{
+			name: "aws nitro",
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor":   "Amazon EC2\n",
+				"sys/class/dmi/id/product_name": "m5.large\n",
+				"proc/cpuinfo":                  cpuinfoHypervisor,
+			},
+			hypervisor: HypervisorKVM,
+			cloud:      CloudAWS,
+			platform:   PlatformVM,
+		},
+		{
+			name: "aws bare metal",
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor":   "Amazon EC2\n",
+				"sys/class/dmi/id/product_name": "i3.metal\n",
+				"proc/cpuinfo":                  "flags\t\t: fpu vme\n",
+				"etc/os-release":                "NAME=\"Ubuntu\"\nID=ubuntu\n",
+			},
+			cloud:    CloudAWS,
+			platform: PlatformUbuntu,
+		},
+		{
+			name: "aws xen",
+			files: map[string]string{
+				"sys/class/dmi/id/product_name": "HVM domU\n",
+				"sys/class/dmi/id/bios_vendor":  "Xen\n",
+				"sys/class/dmi/id/bios_version": "4.2.amazon\n",
+			},
+			hypervisor: HypervisorXen,
+			cloud:      CloudAWS,
+			platform:   PlatformVM,
+		},
+		{
+			name: "gcp",
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor":   "Google\n",
+				"sys/class/dmi/id/product_name": "Google Compute Engine\n",
+				"proc/cpuinfo":                  cpuinfoHypervisor,
+			},
+			hypervisor: HypervisorKVM,
+			cloud:      CloudGCP,
+			platform:   PlatformVM,
+		},
+		{
+			name:     "chromebook",
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "Google\n", "sys/class/dmi/id/product_name": "Eve\n"},
+			platform: PlatformLinux,
+		},
+		{
+			name:       "unidentified hypervisor",
+			files:      map[string]string{"proc/cpuinfo": cpuinfoHypervisor},
+			hypervisor: HypervisorOther,
+			platform:   PlatformVM,
+		},
+		{
+			name:       "wsl2",
+			files:      map[string]string{"proc/sys/kernel/osrelease": "5.15.153.1-microsoft-standard-WSL2\n", "proc/cpuinfo": cpuinfoHypervisor},
+			hypervisor: HypervisorHyperV,
+			wsl:        true,
+			platform:   PlatformVM,
+		},
+		{
+			name:     "wsl from environment",
+			env:      map[string]string{"WSL_DISTRO_NAME": "Ubuntu"},
+			wsl:      true,
+			platform: PlatformLinux,
+		},
+		{
+			name:      "docker",
+			files:     map[string]string{".dockerenv": "", "proc/self/cgroup": "0::/\n"},
+			container: ContainerDocker,
+			platform:  PlatformLinux,
+		},
+		{
+			name:      "docker cgroup v1",
+			files:     map[string]string{"proc/self/cgroup": "12:memory:/docker/3f2a9c\n"},
+			container: ContainerDocker,
+			platform:  PlatformLinux,
+		},
+		{
+			name:      "docker cgroup v2",
+			files:     map[string]string{"proc/self/mountinfo": "612 590 259:1 /var/lib/docker/containers/3f2a9c/hostname /etc/hostname rw\n"},
+			container: ContainerDocker,
+			platform:  PlatformLinux,
+		},
+		{
+			name:      "podman",
+			files:     map[string]string{"run/.containerenv": "engine=\"podman-4.9.3\"\n"},
+			env:       map[string]string{"container": "podman"},
+			container: ContainerPodman,
+			platform:  PlatformLinux,
+		},
+		{
+			name:      "lxc from pid 1 environment",
+			files:     map[string]string{"proc/1/environ": "PATH=/usr/bin\x00container=lxc\x00"},
+			container: ContainerLXC,
+			platform:  PlatformLinux,
+		},
+		{
+			name:      "kubernetes",
+			files:     map[string]string{"proc/self/cgroup": "0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-3f2a9c.scope\n"},
+			env:       map[string]string{"KUBERNETES_SERVICE_HOST": "10.96.0.1"},
+			container: ContainerKubernetes,
+			platform:  PlatformLinux,
+		},
+		{
+			name:      "systemd-nspawn",
+			env:       map[string]string{"container": "systemd-nspawn"},
+			container: ContainerOther,
+			platform:  PlatformLinux,
+		},
+		{
+			name:     "lxcfs on the host",
+			files:    map[string]string{"proc/self/cgroup": "0::/system.slice/lxcfs.service\n", "proc/1/cgroup": "0::/init.scope\n"},
+			platform: PlatformLinux,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := testDetector(testutil.FixtureRoot(t, tt.files), tt.env).detect("")
+			if info.Hypervisor != tt.hypervisor {
+				t.Errorf("expected hypervisor %q, got %q", tt.hypervisor, info.Hypervisor)
+			}
+			if info.Virtualization != (tt.hypervisor != "") {
+				t.Errorf("expected Virtualization=%v", tt.hypervisor != "")
+			}
+			if info.Container != tt.container {
+				t.Errorf("expected container %q, got %q", tt.container, info.Container)
+			}
+			if info.Cloud != tt.cloud {
+				t.Errorf("expected cloud %q, got %q", tt.cloud, info.Cloud)
+			}
+			if info.WSL != tt.wsl {
+				t.Errorf("expected WSL=%v, got %v", tt.wsl, info.WSL)
+			}
+			if info.Platform != tt.platform {
+				t.Errorf("expected platform %q, got %q", tt.platform, info.Platform)
+			}
+		})
+	}
+}
+
+func TestDetectOverrideKeepsEnvironment(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{".dockerenv": "", "sys/class/dmi/id/sys_vendor": "VMware, Inc.\n"})
+	info := testDetector(root, nil).detect(PlatformUbuntu)
+	if info.Platform != PlatformUbuntu {
+		t.Errorf("expected overridden platform, got %q", info.Platform)
+	}
+	if info.Container != ContainerDocker || info.Hypervisor != HypervisorVMware {
+		t.Errorf("expected environment to be detected, got %+v", info)
+	}
+}
+
+func TestRaspberryPiOnArmAndArm64(t *testing.T) {
+	root := testutil.FixtureRoot(t, map[string]string{
+		"proc/device-tree/model": "Raspberry Pi 3 Model B Plus Rev 1.3\x00",
+		"etc/os-release":         "ID=raspbian\nID_LIKE=debian\n",
+	})
+	for arch, want := range map[string]string{"arm": PlatformRaspberryPi, "arm64": PlatformRaspberryPi, "amd64": PlatformLinux} {
+		d := testDetector(root, nil)
+		d.goarch = arch
+		if got := d.detect("").Platform; got != want {
+			t.Errorf("%s: expected %q, got %q", arch, want, got)
+		}
+	}
+
+	// Without a device tree, the Model line of cpuinfo identifies the board.
+	root = testutil.FixtureRoot(t, map[string]string{
+		"proc/cpuinfo": "processor\t: 0\nmodel name\t: ARMv7 Processor rev 4 (v7l)\n\nHardware\t: BCM2835\nRevision\t: a02082\nModel\t\t: Raspberry Pi 3 Model B Rev 1.2\n",
+	})
+	d := testDetector(root, nil)
+	d.goarch = "arm"
+	if info := d.detect(""); info.Platform != PlatformRaspberryPi || info.Identity.PiRevision != "a02082" {
+		t.Errorf("expected Raspberry Pi from cpuinfo, got %q revision %q", info.Platform, info.Identity.PiRevision)
+	}
+}
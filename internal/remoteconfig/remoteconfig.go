@@ -0,0 +1,277 @@
+package remoteconfig
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binary-gws/agent/internal/fileutil"
+)
+
+const FileName = "remote_config.json"
+
+// SignatureVersion prefixes the signed message so a bundle signature can
+// never be confused with any other signature made with the same key.
+const SignatureVersion = "gw-config-v1"
+
+// Bundle is a versioned config overlay published by the backend. Config is
+// YAML merged over the local config files; Signature is the base64 Ed25519
+// signature of SigningMessage(Version, Config).
+type Bundle struct {
+	Version   int64  `json:"version"`
+	Config    string `json:"config"`
+	Signature string `json:"signature"`
+}
+
+// Label names the bundle in config origins and logs.
+func (b *Bundle) Label() string {
+	return fmt.Sprintf("remote config v%d", b.Version)
+}
+
+// SigningMessage returns the bytes a bundle signature covers: the signature
+// version, the bundle version and the hex SHA-256 of the config, joined by
+// newlines.
+func SigningMessage(version int64, config []byte) []byte {
+	sum := sha256.Sum256(config)
+	return []byte(strings.Join([]string{
+		SignatureVersion,
+		strconv.FormatInt(version, 10),
+		hex.EncodeToString(sum[:]),
+	}, "\n"))
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not valid base64")
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Parse decodes a bundle as served by the backend.
+func Parse(data []byte) (*Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse config bundle: %w", err)
+	}
+	if b.Version <= 0 {
+		return nil, fmt.Errorf("config bundle version must be positive")
+	}
+	return &b, nil
+}
+
+// Verify checks the bundle signature against the pinned key.
+func (b *Bundle) Verify(key ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(b.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("config bundle v%d has a malformed signature", b.Version)
+	}
+	if !ed25519.Verify(key, SigningMessage(b.Version, []byte(b.Config)), sig) {
+		return fmt.Errorf("config bundle v%d signature does not match the pinned key", b.Version)
+	}
+	return nil
+}
+
+// State is the persisted remote config state.
+type State struct {
+	// Active is the overlay in effect. It is on probation until Confirmed,
+	// i.e. until a heartbeat has succeeded with it.
+	Active    *Bundle `json:"active,omitempty"`
+	Confirmed bool    `json:"confirmed"`
+	AppliedAt string  `json:"applied_at,omitempty"`
+	// LastGood is the overlay to roll back to while Active is on probation;
+	// nil means rolling back removes the overlay.
+	LastGood *Bundle `json:"last_good,omitempty"`
+	// HighestVersion is the highest version ever applied or rejected. Only
+	// newer bundles are considered, so neither a replayed old bundle nor a
+	// rolled-back one is applied again.
+	HighestVersion    int64 `json:"highest_version"`
+	RolledBackVersion int64 `json:"rolled_back_version,omitempty"`
+	RejectedVersion   int64 `json:"rejected_version,omitempty"`
+}
+
+// Status is reported in the heartbeat payload.
+type Status struct {
+	Version           int64  `json:"version"`
+	Confirmed         bool   `json:"confirmed"`
+	AppliedAt         string `json:"applied_at,omitempty"`
+	RolledBackVersion int64  `json:"rolled_back_version,omitempty"`
+	RejectedVersion   int64  `json:"rejected_version,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// Store keeps the remote config state in a 0600 file under the data
+// directory.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	state   State
+	lastErr string
+}
+
+// Active returns the active overlay stored in dir, or nil.
+func Active(dir string) (*Bundle, error) {
+	state, err := load(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, err
+	}
+	return state.Active, nil
+}
+
+// Open loads the remote config state in dir.
+func Open(dir string) (*Store, error) {
+	st := &Store{path: filepath.Join(dir, FileName)}
+	state, err := load(st.path)
+	if err != nil {
+		return st, err
+	}
+	st.state = *state
+	return st, nil
+}
+
+func load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote config state: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse remote config state: %w", err)
+	}
+	return &state, nil
+}
+
+// State returns a copy of the stored state.
+func (st *Store) State() State {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.state
+}
+
+// Pending reports whether the active overlay is still on probation.
+func (st *Store) Pending() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.state.Active != nil && !st.state.Confirmed
+}
+
+// Status returns the payload status, or nil if remote config has never
+// been used.
+func (st *Store) Status() *Status {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state.HighestVersion == 0 && st.lastErr == "" {
+		return nil
+	}
+	status := &Status{
+		Confirmed:         st.state.Confirmed,
+		AppliedAt:         st.state.AppliedAt,
+		RolledBackVersion: st.state.RolledBackVersion,
+		RejectedVersion:   st.state.RejectedVersion,
+		Error:             st.lastErr,
+	}
+	if st.state.Active != nil {
+		status.Version = st.state.Active.Version
+	}
+	return status
+}
+
+// SetError records the outcome of the last fetch for Status; nil clears it.
+func (st *Store) SetError(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.lastErr = ""
+	if err != nil {
+		st.lastErr = err.Error()
+	}
+}
+
+// Activate makes b the active overlay, on probation. The current overlay
+// becomes the rollback target if it was confirmed; otherwise the existing
+// rollback target is kept.
+func (st *Store) Activate(b *Bundle) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	state := st.state
+	if state.Active != nil && state.Confirmed {
+		state.LastGood = state.Active
+	}
+	state.Active = b
+	state.Confirmed = false
+	state.AppliedAt = time.Now().UTC().Format(time.RFC3339)
+	state.HighestVersion = max(state.HighestVersion, b.Version)
+	return st.save(state)
+}
+
+// Confirm ends the probation of the active overlay.
+func (st *Store) Confirm() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state.Active == nil || st.state.Confirmed {
+		return nil
+	}
+	state := st.state
+	state.Confirmed = true
+	state.LastGood = nil
+	return st.save(state)
+}
+
+// Rollback replaces the active overlay with the last known-good one and
+// returns the version rolled back from.
+func (st *Store) Rollback() (int64, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state.Active == nil {
+		return 0, fmt.Errorf("no remote config to roll back")
+	}
+	state := st.state
+	state.RolledBackVersion = state.Active.Version
+	state.Active = state.LastGood
+	state.LastGood = nil
+	state.Confirmed = true
+	state.AppliedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := st.save(state); err != nil {
+		return 0, err
+	}
+	return state.RolledBackVersion, nil
+}
+
+// Reject records that version failed validation so it is not fetched and
+// tried again.
+func (st *Store) Reject(version int64) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	state := st.state
+	state.RejectedVersion = version
+	state.HighestVersion = max(state.HighestVersion, version)
+	return st.save(state)
+}
+
+func (st *Store) save(state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFileAtomic(st.path, data); err != nil {
+		return fmt.Errorf("failed to write remote config state: %w", err)
+	}
+	st.state = state
+	return nil
+}
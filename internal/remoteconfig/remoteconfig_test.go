@@ -0,0 +1,188 @@
+package remoteconfig
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func signedBundle(t *testing.T, priv ed25519.PrivateKey, version int64, config string) *Bundle {
+	t.Helper()
+	sig := ed25519.Sign(priv, SigningMessage(version, []byte(config)))
+	return &Bundle{Version: version, Config: config, Signature: base64.StdEncoding.EncodeToString(sig)}
+}
+
+func TestVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := signedBundle(t, priv, 3, "intervals:\n  heartbeat_seconds: 30\n")
+	if err := good.Verify(pub); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	if err := good.Verify(otherPub); err == nil {
+		t.Error("expected error for a different key")
+	}
+
+	tampered := *good
+	tampered.Config = "intervals:\n  heartbeat_seconds: 5\n"
+	if err := tampered.Verify(pub); err == nil {
+		t.Error("expected error for tampered config")
+	}
+
+	replayed := *good
+	replayed.Version = 4
+	if err := replayed.Verify(pub); err == nil {
+		t.Error("expected error when the version is changed")
+	}
+
+	malformed := *good
+	malformed.Signature = "not base64"
+	if err := malformed.Verify(pub); err == nil {
+		t.Error("expected error for malformed signature")
+	}
+}
+
+func TestParse(t *testing.T) {
+	data, _ := json.Marshal(Bundle{Version: 7, Config: "logging:\n  level: debug\n", Signature: "sig"})
+	b, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if b.Version != 7 || b.Label() != "remote config v7" {
+		t.Errorf("unexpected bundle %+v", b)
+	}
+	if _, err := Parse([]byte(`{"version":0,"config":""}`)); err == nil {
+		t.Error("expected error for version 0")
+	}
+	if _, err := Parse([]byte(`not json`)); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Errorf("expected valid key, got %v", err)
+	}
+	if _, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub[:16])); err == nil {
+		t.Error("expected error for short key")
+	}
+	if _, err := ParsePublicKey("%%%"); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+}
+
+func TestStoreProbationAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	st, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if st.Status() != nil {
+		t.Error("expected no status before any bundle")
+	}
+
+	v1 := &Bundle{Version: 1, Config: "a: 1"}
+	v2 := &Bundle{Version: 2, Config: "a: 2"}
+	v3 := &Bundle{Version: 3, Config: "a: 3"}
+
+	if err := st.Activate(v1); err != nil {
+		t.Fatal(err)
+	}
+	if !st.Pending() {
+		t.Error("expected v1 to be on probation")
+	}
+	if err := st.Confirm(); err != nil {
+		t.Fatal(err)
+	}
+
+	// v2 and v3 are applied without a successful heartbeat in between; the
+	// rollback target stays v1, the last confirmed overlay.
+	if err := st.Activate(v2); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Activate(v3); err != nil {
+		t.Fatal(err)
+	}
+	version, err := st.Rollback()
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if version != 3 {
+		t.Errorf("expected rollback from v3, got v%d", version)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	state := reopened.State()
+	if state.Active == nil || state.Active.Version != 1 || !state.Confirmed {
+		t.Errorf("expected confirmed v1 after rollback, got %+v", state)
+	}
+	if state.HighestVersion != 3 || state.RolledBackVersion != 3 {
+		t.Errorf("expected highest and rolled back version 3, got %+v", state)
+	}
+	if active, err := Active(dir); err != nil || active.Version != 1 {
+		t.Errorf("Active() = %v, %v; want v1", active, err)
+	}
+
+	status := reopened.Status()
+	if status == nil || status.Version != 1 || status.RolledBackVersion != 3 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("state file should be owner-only, got %v", info.Mode().Perm())
+	}
+}
+
+func TestStoreRollbackWithoutLastGoodRemovesOverlay(t *testing.T) {
+	st, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Rollback(); err == nil {
+		t.Error("expected error with nothing to roll back")
+	}
+	if err := st.Activate(&Bundle{Version: 5, Config: "a: 5"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if state := st.State(); state.Active != nil || st.Pending() {
+		t.Errorf("expected no active overlay, got %+v", state)
+	}
+}
+
+func TestStoreReject(t *testing.T) {
+	st, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Reject(9); err != nil {
+		t.Fatal(err)
+	}
+	state := st.State()
+	if state.HighestVersion != 9 || state.RejectedVersion != 9 || state.Active != nil {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+const (
+	PayloadModeFull  = "full"
+	PayloadModeDelta = "delta"
+
+	DefaultFullSnapshotEvery = 20
+)
+
+// envelopeFields are copied into every delta so the backend can route and
+// order it without consulting the base snapshot.
+var envelopeFields = map[string]bool{
+	"batch_index":         true,
+	"payload_version":     true,
+	"payload_mode":        true,
+	"base_batch_index":    true,
+	"uuid":                true,
+	"client_id":           true,
+	"site_id":             true,
+	"session":             true,
+	"directive_acks":      true,
+	"log_entries":         true,
+	"agent_timestamp_utc": true,
+}
+
+// toMap round-trips v through JSON so deltas are computed over exactly what
+// goes on the wire.
+func toMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// buildDelta returns current expressed as a JSON Merge Patch (RFC 7386)
+// against base: changed values are included, unchanged values are omitted,
+// removed keys are set to null and arrays are replaced wholesale. Applying
+// the result to base yields current.
+func buildDelta(base, current map[string]interface{}) map[string]interface{} {
+	delta := diffObjects(base, current)
+	for key := range envelopeFields {
+		if v, ok := current[key]; ok {
+			delta[key] = v
+		} else {
+			delete(delta, key)
+		}
+	}
+	return delta
+}
+
+func diffObjects(base, current map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{})
+	for key, cur := range current {
+		prev, existed := base[key]
+		if !existed {
+			delta[key] = cur
+			continue
+		}
+		curObj, curIsObj := cur.(map[string]interface{})
+		prevObj, prevIsObj := prev.(map[string]interface{})
+		if curIsObj && prevIsObj {
+			if nested := diffObjects(prevObj, curObj); len(nested) > 0 {
+				delta[key] = nested
+			}
+			continue
+		}
+		if !reflect.DeepEqual(prev, cur) {
+			delta[key] = cur
+		}
+	}
+	for key := range base {
+		if _, ok := current[key]; !ok {
+			delta[key] = nil
+		}
+	}
+	return delta
+}
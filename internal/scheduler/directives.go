@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/binary-gws/agent/internal/logging"
+	"github.com/binary-gws/agent/internal/transport"
+)
+
+// ResponseVersion is the major version of the heartbeat response schema the
+// agent understands. Responses with another major version are ignored.
+const ResponseVersion = "1"
+
+const (
+	DirectiveSetHeartbeatInterval = "set_heartbeat_interval"
+	DirectiveFullSnapshot         = "full_snapshot"
+	DirectiveSetLogLevel          = "set_log_level"
+	DirectiveRotateToken          = "rotate_token"
+	DirectiveConfirmToken         = "confirm_token"
+	DirectiveFetchConfig          = "fetch_config"
+)
+
+const (
+	AckApplied  = "applied"
+	AckRejected = "rejected"
+	AckIgnored  = "ignored"
+)
+
+const (
+	minHeartbeatInterval   = 5 * time.Second
+	maxHeartbeatInterval   = time.Hour
+	maxRememberedDirective = 100
+)
+
+// Response is the body a backend may return on a 2xx heartbeat response.
+// Bodies that are empty, not JSON or lack a version are treated as carrying
+// no directives.
+type Response struct {
+	Version    string      `json:"version"`
+	Directives []Directive `json:"directives,omitempty"`
+}
+
+type Directive struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// DirectiveAck reports the outcome of a directive in the next payload.
+type DirectiveAck struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type heartbeatIntervalParams struct {
+	Seconds int `json:"seconds"`
+}
+
+type logLevelParams struct {
+	Level           string `json:"level"`
+	DurationSeconds int    `json:"duration_seconds"`
+}
+
+type rotateTokenParams struct {
+	Token string `json:"token"`
+}
+
+func parseResponse(body []byte) (*Response, error) {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil, nil
+	}
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil
+	}
+	if resp.Version == "" {
+		return nil, nil
+	}
+	major := strings.SplitN(resp.Version, ".", 2)[0]
+	if major != ResponseVersion {
+		return nil, fmt.Errorf("unsupported response version %s", resp.Version)
+	}
+	return &resp, nil
+}
+
+// handleResponse applies the directives in a heartbeat response and queues
+// their acknowledgements for the next payload.
+func (s *Scheduler) handleResponse(tresp *transport.Response) {
+	resp, err := parseResponse(tresp.Body)
+	if err != nil {
+		s.config.Logger.Warn("Ignoring heartbeat response", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if resp == nil {
+		return
+	}
+
+	for _, d := range resp.Directives {
+		if d.ID != "" && s.seenDirective(d.ID) {
+			continue
+		}
+		ack := s.applyDirective(d, tresp.TokenSlot)
+		s.pendingAcks = append(s.pendingAcks, ack)
+
+		fields := map[string]interface{}{
+			"directive_id":   d.ID,
+			"directive_type": d.Type,
+			"status":         ack.Status,
+		}
+		if ack.Error != "" {
+			fields["error"] = ack.Error
+		}
+		if ack.Status == AckApplied {
+			s.config.Logger.Info("Applied backend directive", fields)
+		} else {
+			s.config.Logger.Warn("Backend directive not applied", fields)
+		}
+	}
+}
+
+func (s *Scheduler) seenDirective(id string) bool {
+	for _, seen := range s.recentDirectives {
+		if seen == id {
+			return true
+		}
+	}
+	s.recentDirectives = append(s.recentDirectives, id)
+	if len(s.recentDirectives) > maxRememberedDirective {
+		s.recentDirectives = s.recentDirectives[1:]
+	}
+	return false
+}
+
+// applyDirective applies d. tokenSlot is the token that authenticated the
+// response carrying it.
+func (s *Scheduler) applyDirective(d Directive, tokenSlot string) DirectiveAck {
+	ack := DirectiveAck{ID: d.ID, Type: d.Type, Status: AckApplied}
+	reject := func(err error) DirectiveAck {
+		ack.Status = AckRejected
+		ack.Error = err.Error()
+		return ack
+	}
+
+	switch d.Type {
+	case DirectiveSetHeartbeatInterval:
+		var p heartbeatIntervalParams
+		if err := json.Unmarshal(d.Params, &p); err != nil {
+			return reject(fmt.Errorf("invalid params: %v", err))
+		}
+		interval := time.Duration(p.Seconds) * time.Second
+		if interval < minHeartbeatInterval || interval > maxHeartbeatInterval {
+			return reject(fmt.Errorf("seconds must be between %d and %d", int(minHeartbeatInterval.Seconds()), int(maxHeartbeatInterval.Seconds())))
+		}
+		s.SetHeartbeatInterval(interval)
+
+	case DirectiveFullSnapshot:
+		s.RequestFullSnapshot()
+
+	case DirectiveSetLogLevel:
+		var p logLevelParams
+		if err := json.Unmarshal(d.Params, &p); err != nil {
+			return reject(fmt.Errorf("invalid params: %v", err))
+		}
+		level, ok := logging.LookupLevel(p.Level)
+		if !ok {
+			return reject(fmt.Errorf("unknown level %q", p.Level))
+		}
+		duration := logging.LevelTimeout(time.Duration(p.DurationSeconds) * time.Second)
+		s.config.Logger.SetLevelFor(level, duration)
+
+	case DirectiveRotateToken:
+		var p rotateTokenParams
+		if err := json.Unmarshal(d.Params, &p); err != nil {
+			return reject(fmt.Errorf("invalid params: %v", err))
+		}
+		if strings.TrimSpace(p.Token) == "" {
+			return reject(fmt.Errorf("token is empty"))
+		}
+		if s.config.Transport == nil {
+			return reject(fmt.Errorf("no transport"))
+		}
+		s.tokenMu.Lock()
+		defer s.tokenMu.Unlock()
+		s.config.Logger.Redact(p.Token)
+		current := s.config.Transport.Tokens()[0]
+		if p.Token == current {
+			break
+		}
+		// Persist before switching so a restart never falls back to a token
+		// the backend may already have retired.
+		if s.config.TokenStore != nil {
+			if err := s.config.TokenStore.Rotate(p.Token, current, s.configToken, d.ID); err != nil {
+				return reject(err)
+			}
+		}
+		s.config.Transport.SetTokens(p.Token, current)
+
+	case DirectiveConfirmToken:
+		if s.config.Transport == nil {
+			return reject(fmt.Errorf("no transport"))
+		}
+		s.tokenMu.Lock()
+		defer s.tokenMu.Unlock()
+		// Only a response authenticated by the current token proves the
+		// backend accepts it; otherwise dropping grace could lock us out.
+		if tokenSlot != transport.TokenSlotCurrent {
+			return reject(fmt.Errorf("current token was not used for this request"))
+		}
+		if s.config.TokenStore != nil && s.config.TokenStore.State() != nil {
+			if err := s.config.TokenStore.Confirm(); err != nil {
+				return reject(err)
+			}
+		}
+		s.config.Transport.SetTokens(s.config.Transport.Tokens()[0], "")
+
+	case DirectiveFetchConfig:
+		if s.config.RemoteConfig == nil {
+			return reject(fmt.Errorf("remote config is not enabled"))
+		}
+		s.config.RemoteConfig.RequestFetch()
+
+	default:
+		ack.Status = AckIgnored
+		ack.Error = "unknown directive type"
+	}
+
+	return ack
+}
@@ -3,11 +3,18 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/binary-gws/agent/internal/collector"
+	"github.com/binary-gws/agent/internal/credentials"
 	"github.com/binary-gws/agent/internal/logging"
 	"github.com/binary-gws/agent/internal/platform"
+	"github.com/binary-gws/agent/internal/remoteconfig"
+	"github.com/binary-gws/agent/internal/session"
 	"github.com/binary-gws/agent/internal/transport"
 )
 
@@ -23,17 +30,66 @@ type Config struct {
 	Version          string
 	Commit           string
 	BuildDate        string
+	// PayloadMode is PayloadModeFull (default) or PayloadModeDelta. In delta
+	// mode only fields changed since the last acknowledged payload are sent,
+	// with a full snapshot every FullSnapshotEvery heartbeats.
+	PayloadMode       string
+	FullSnapshotEvery int
+	// Session identifies this process; PreviousSession is the record left by
+	// the last run, if any.
+	Session         *session.Session
+	PreviousSession *session.Record
+	// TokenStore persists tokens issued by the backend. ConfigToken is
+	// auth.token_current from the config file, which anchors the stored state.
+	TokenStore  *credentials.Store
+	ConfigToken string
+	// RemoteConfig, when set, handles fetch_config directives and is told
+	// the outcome of every heartbeat so it can roll back a bad overlay.
+	RemoteConfig RemoteConfig
+	// RecentLogs, when set, supplies the warnings and errors logged since
+	// the last acknowledged heartbeat, up to LogEntriesMaxBytes of them.
+	RecentLogs         *logging.Recent
+	LogEntriesMaxBytes int
+	// ReadIdentity, when set, re-reads the host identity before each
+	// heartbeat; otherwise Platform.Identity is used throughout.
+	ReadIdentity func() platform.Identity
+}
+
+// RemoteConfig is the scheduler's view of remote configuration bundles.
+type RemoteConfig interface {
+	// RequestFetch asks for a bundle fetch soon; it must not block.
+	RequestFetch()
+	// HeartbeatResult reports the outcome of a heartbeat; it must not block.
+	HeartbeatResult(err error)
+	Status() *remoteconfig.Status
 }
 
 type Payload struct {
 	BatchIndex      int             `json:"batch_index"`
 	PayloadVersion  string          `json:"payload_version"`
+	PayloadMode     string          `json:"payload_mode,omitempty"`
+	BaseBatchIndex  int             `json:"base_batch_index,omitempty"`
 	UUID            string          `json:"uuid"`
 	ClientID        string          `json:"client_id"`
 	SiteID          string          `json:"site_id"`
+	Session         *SessionInfo    `json:"session,omitempty"`
+	DirectiveAcks   []DirectiveAck  `json:"directive_acks,omitempty"`
+	LogEntries      []logging.RecentEntry `json:"log_entries,omitempty"`
 	Stats           Stats           `json:"stats"`
 	Additional      Additional      `json:"additional"`
 	AgentTimestamp  string          `json:"agent_timestamp_utc,omitempty"`
+
+	// logCursor is the Seq of the last entry in LogEntries.
+	logCursor uint64
+	// fullRequests is Scheduler.fullRequests when the payload was built.
+	fullRequests uint64
+}
+
+// SessionInfo lets the backend de-duplicate retried heartbeats by
+// (session.id, batch_index) and detect restarts through Previous.
+type SessionInfo struct {
+	session.Session
+	Previous *session.Record `json:"previous,omitempty"`
 }
 
 type Stats struct {
@@ -43,26 +99,174 @@ type Stats struct {
 }
 
 type Additional struct {
-	Metadata Metadata `json:"metadata"`
+	Metadata  Metadata         `json:"metadata"`
+	Transport *transport.Stats `json:"transport,omitempty"`
+	Auth      *AuthInfo        `json:"auth,omitempty"`
+	// RemoteConfig describes the active remote config overlay.
+	RemoteConfig *remoteconfig.Status `json:"remote_config,omitempty"`
+}
+
+// AuthInfo describes the credentials in use without revealing them.
+type AuthInfo struct {
+	TokenFingerprint string `json:"token_fingerprint"`
+	GraceFingerprint string `json:"grace_fingerprint,omitempty"`
+	RotationPending  bool   `json:"rotation_pending"`
+	RotatedAt        string `json:"rotated_at,omitempty"`
 }
 
 type Metadata struct {
 	Platform     string `json:"platform"`
 	AgentVersion string `json:"agent_version,omitempty"`
 	Build        string `json:"build,omitempty"`
+	Hypervisor   string `json:"hypervisor,omitempty"`
+	Container    string `json:"container,omitempty"`
+	WSL          bool   `json:"wsl,omitempty"`
+	Cloud        string `json:"cloud,omitempty"`
+	// Identity is sent until the backend acknowledges it and again after
+	// it changes. Delta payloads always carry it, as deltas only send
+	// changes anyway.
+	Identity *platform.Identity `json:"identity,omitempty"`
 }
 
+// DefaultLogEntriesMaxBytes caps the log entries in one payload.
+const DefaultLogEntriesMaxBytes = 8192
+
 type Scheduler struct {
 	config              Config
 	consecutiveFailures int
 	lastSuccessAt       *time.Time
 	batchCounter        int
+
+	// Delta mode state: the last payload the backend acknowledged with a
+	// 2xx, and how many deltas have been acknowledged on top of it.
+	lastAcked       map[string]interface{}
+	lastAckedIndex  int
+	deltasSinceFull int
+	// fullRequests counts RequestFullSnapshot calls; fullServed is the
+	// count the last acknowledged full snapshot was built after.
+	fullRequests atomic.Uint64
+	fullServed   uint64
+
+	heartbeatInterval atomic.Int64
+	pendingAcks       []DirectiveAck
+	recentDirectives  []string
+	// logCursor is the Seq of the last log entry the backend acknowledged.
+	logCursor uint64
+	// identity is the host identity last read; ackedIdentity is the one
+	// the backend last acknowledged.
+	identity      platform.Identity
+	ackedIdentity *platform.Identity
+
+	// tokenMu serialises token changes from directives with config token
+	// refreshes; configToken starts as Config.ConfigToken.
+	tokenMu     sync.Mutex
+	configToken string
 }
 
 func New(cfg Config) *Scheduler {
-	return &Scheduler{
-		config: cfg,
+	if cfg.PayloadMode == PayloadModeDelta && cfg.FullSnapshotEvery <= 0 {
+		cfg.FullSnapshotEvery = DefaultFullSnapshotEvery
+	}
+	if cfg.LogEntriesMaxBytes <= 0 {
+		cfg.LogEntriesMaxBytes = DefaultLogEntriesMaxBytes
+	}
+	s := &Scheduler{
+		config:      cfg,
+		configToken: cfg.ConfigToken,
+	}
+	if cfg.Platform != nil {
+		s.identity = cfg.Platform.Identity
+	}
+	s.heartbeatInterval.Store(int64(time.Duration(cfg.HeartbeatSeconds) * time.Second))
+	return s
+}
+
+// SetHeartbeatInterval changes the interval used by Run from the next tick.
+func (s *Scheduler) SetHeartbeatInterval(d time.Duration) {
+	s.heartbeatInterval.Store(int64(d))
+}
+
+func (s *Scheduler) HeartbeatInterval() time.Duration {
+	return time.Duration(s.heartbeatInterval.Load())
+}
+
+// BatchIndex returns the index of the most recently built payload.
+func (s *Scheduler) BatchIndex() int {
+	return s.batchCounter
+}
+
+// UpdateConfigTokens applies tokens re-read from their configured sources.
+// As at startup, a changed config token takes precedence over tokens issued
+// by backend rotation.
+func (s *Scheduler) UpdateConfigTokens(current, grace string) {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+
+	if current != s.configToken && s.config.TokenStore != nil && s.config.TokenStore.State() != nil {
+		if err := s.config.TokenStore.Discard(); err != nil {
+			s.config.Logger.Warn("Failed to discard rotated tokens", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	s.configToken = current
+	if s.config.TokenStore != nil && s.config.TokenStore.State() != nil {
+		// Only the grace token changed; keep the backend-issued tokens.
+		return
+	}
+	s.config.Transport.SetTokens(current, grace)
+	s.config.Logger.Info("Reloaded tokens from configured source", map[string]interface{}{
+		"token_fingerprint": credentials.Fingerprint(current),
+		"grace_configured":  grace != "",
+	})
+}
+
+// RequestFullSnapshot makes the next heartbeat carry a full snapshot even in
+// delta mode, for example when the backend has lost its copy of the state.
+func (s *Scheduler) RequestFullSnapshot() {
+	s.fullRequests.Add(1)
+}
+
+// wireBody returns what is sent for payload and the full snapshot to store
+// as the new base if the backend acknowledges it.
+func (s *Scheduler) wireBody(payload *Payload) (interface{}, map[string]interface{}, error) {
+	if s.config.PayloadMode != PayloadModeDelta {
+		return payload, nil, nil
+	}
+
+	payload.fullRequests = s.fullRequests.Load()
+	full := s.lastAcked == nil || payload.fullRequests != s.fullServed || s.deltasSinceFull+1 >= s.config.FullSnapshotEvery
+	if full {
+		payload.PayloadMode = PayloadModeFull
+	} else {
+		payload.PayloadMode = PayloadModeDelta
+		payload.BaseBatchIndex = s.lastAckedIndex
+	}
+
+	snapshot, err := toMap(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if full {
+		return snapshot, snapshot, nil
 	}
+	return buildDelta(s.lastAcked, snapshot), snapshot, nil
+}
+
+func (s *Scheduler) ackPayload(payload *Payload, snapshot map[string]interface{}) {
+	if snapshot == nil {
+		return
+	}
+	if payload.PayloadMode == PayloadModeFull {
+		s.deltasSinceFull = 0
+		// A request made while this payload was in flight is still
+		// pending.
+		s.fullServed = payload.fullRequests
+	} else {
+		s.deltasSinceFull++
+	}
+	s.lastAcked = snapshot
+	s.lastAckedIndex = payload.BatchIndex
 }
 
 func (s *Scheduler) buildPayload() *Payload {
@@ -80,12 +284,43 @@ func (s *Scheduler) buildPayload() *Payload {
 		},
 		Additional: Additional{
 			Metadata: Metadata{
-				Platform: s.config.Platform.Platform,
+				Platform:   s.config.Platform.Platform,
+				Hypervisor: s.config.Platform.Hypervisor,
+				Container:  s.config.Platform.Container,
+				WSL:        s.config.Platform.WSL,
+				Cloud:      s.config.Platform.Cloud,
 			},
 		},
 		AgentTimestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
+	if s.config.Session != nil {
+		payload.Session = &SessionInfo{
+			Session:  *s.config.Session,
+			Previous: s.config.PreviousSession,
+		}
+	}
+
+	if len(s.pendingAcks) > 0 {
+		payload.DirectiveAcks = append([]DirectiveAck(nil), s.pendingAcks...)
+	}
+	payload.logCursor = s.logCursor
+	if identity := s.readIdentity(); s.config.PayloadMode == PayloadModeDelta ||
+		s.ackedIdentity == nil || !reflect.DeepEqual(*s.ackedIdentity, identity) {
+		payload.Additional.Metadata.Identity = &identity
+	}
+	if s.config.RecentLogs != nil {
+		payload.LogEntries, payload.logCursor = s.config.RecentLogs.Since(s.logCursor, s.config.LogEntriesMaxBytes)
+	}
+
+	if s.config.Transport != nil {
+		payload.Additional.Transport = s.config.Transport.Stats()
+		payload.Additional.Auth = s.authInfo()
+	}
+	if s.config.RemoteConfig != nil {
+		payload.Additional.RemoteConfig = s.config.RemoteConfig.Status()
+	}
+
 	if s.config.Version != "" {
 		payload.Additional.Metadata.AgentVersion = s.config.Version
 	}
@@ -106,6 +341,41 @@ func (s *Scheduler) buildPayload() *Payload {
 	return payload
 }
 
+// readIdentity re-reads the host identity and logs when it has changed.
+func (s *Scheduler) readIdentity() platform.Identity {
+	if s.config.ReadIdentity == nil {
+		return s.identity
+	}
+	identity := s.config.ReadIdentity()
+	if !reflect.DeepEqual(identity, s.identity) {
+		s.config.Logger.Info("Host identity changed", map[string]interface{}{
+			"os_pretty_name": identity.OSPrettyName,
+			"kernel":         identity.Kernel,
+			"hostname":       identity.Hostname,
+			"model":          identity.Model,
+		})
+		s.identity = identity
+	}
+	return identity
+}
+
+func (s *Scheduler) authInfo() *AuthInfo {
+	tokens := s.config.Transport.Tokens()
+	info := &AuthInfo{
+		TokenFingerprint: credentials.Fingerprint(tokens[0]),
+	}
+	if len(tokens) > 1 {
+		info.GraceFingerprint = credentials.Fingerprint(tokens[1])
+	}
+	if s.config.TokenStore != nil {
+		if state := s.config.TokenStore.State(); state != nil {
+			info.RotationPending = !state.Confirmed
+			info.RotatedAt = state.RotatedAt
+		}
+	}
+	return info
+}
+
 func (s *Scheduler) SendOnce(ctx context.Context, dryRun bool) error {
 	payload := s.buildPayload()
 
@@ -120,9 +390,29 @@ func (s *Scheduler) SendOnce(ctx context.Context, dryRun bool) error {
 		return nil
 	}
 
-	err := s.config.Transport.SendHeartbeat(ctx, payload, transport.DefaultRetryConfig, nil)
+	body, snapshot, err := s.wireBody(payload)
+	if err != nil {
+		return err
+	}
+
+	var opts transport.SendOptions
+	if s.config.Session != nil {
+		opts.IdempotencyKey = s.config.Session.IdempotencyKey(payload.BatchIndex)
+	}
+
+	resp, err := s.config.Transport.SendHeartbeatWithOptions(ctx, body, opts, transport.DefaultRetryConfig, nil)
+	if s.config.RemoteConfig != nil {
+		s.config.RemoteConfig.HeartbeatResult(err)
+	}
 	if err != nil {
 		s.consecutiveFailures++
+		if errors.Is(err, transport.ErrPinMismatch) {
+			s.config.Logger.Error("TLS certificate pin mismatch, refusing to send heartbeat", map[string]interface{}{
+				"error":                err.Error(),
+				"consecutive_failures": s.consecutiveFailures,
+			})
+			return err
+		}
 		s.config.Logger.Error("Failed to send heartbeat", map[string]interface{}{
 			"error":               err.Error(),
 			"consecutive_failures": s.consecutiveFailures,
@@ -130,6 +420,15 @@ func (s *Scheduler) SendOnce(ctx context.Context, dryRun bool) error {
 		return err
 	}
 
+	s.ackPayload(payload, snapshot)
+	s.pendingAcks = s.pendingAcks[len(payload.DirectiveAcks):]
+	s.logCursor = payload.logCursor
+	if payload.Additional.Metadata.Identity != nil {
+		s.ackedIdentity = payload.Additional.Metadata.Identity
+	}
+	if resp != nil {
+		s.handleResponse(resp)
+	}
 	now := time.Now()
 	s.lastSuccessAt = &now
 	s.consecutiveFailures = 0
@@ -140,7 +439,8 @@ func (s *Scheduler) SendOnce(ctx context.Context, dryRun bool) error {
 }
 
 func (s *Scheduler) Run(ctx context.Context) error {
-	ticker := time.NewTicker(time.Duration(s.config.HeartbeatSeconds) * time.Second)
+	interval := s.HeartbeatInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	if err := s.SendOnce(ctx, false); err != nil {
@@ -150,6 +450,14 @@ func (s *Scheduler) Run(ctx context.Context) error {
 	}
 
 	for {
+		if next := s.HeartbeatInterval(); next != interval {
+			interval = next
+			ticker.Reset(interval)
+			s.config.Logger.Info("Heartbeat interval changed", map[string]interface{}{
+				"heartbeat_seconds": int(interval.Seconds()),
+			})
+		}
+
 		select {
 		case <-ctx.Done():
 			s.config.Logger.Info("Scheduler stopping", nil)
@@ -3,12 +3,19 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/binary-gws/agent/internal/collector"
+	"github.com/binary-gws/agent/internal/credentials"
 	"github.com/binary-gws/agent/internal/logging"
 	"github.com/binary-gws/agent/internal/platform"
+	"github.com/binary-gws/agent/internal/remoteconfig"
+	"github.com/binary-gws/agent/internal/session"
+	"github.com/binary-gws/agent/internal/transport"
 )
 
 func TestBuildPayload(t *testing.T) {
@@ -152,3 +159,714 @@ func TestDryRun(t *testing.T) {
 		t.Errorf("dry run should not fail: %v", err)
 	}
 }
+
+func TestBuildDeltaMergePatch(t *testing.T) {
+	base := map[string]interface{}{
+		"uuid":        "gw",
+		"batch_index": float64(1),
+		"stats": map[string]interface{}{
+			"system_status": "online",
+			"compute": map[string]interface{}{
+				"memory": map[string]interface{}{"total_bytes": float64(100), "used_bytes": float64(10)},
+			},
+		},
+		"additional": map[string]interface{}{"metadata": map[string]interface{}{"platform": "linux"}},
+		"removed":    "gone",
+	}
+	current := map[string]interface{}{
+		"uuid":        "gw",
+		"batch_index": float64(2),
+		"stats": map[string]interface{}{
+			"system_status": "online",
+			"compute": map[string]interface{}{
+				"memory": map[string]interface{}{"total_bytes": float64(100), "used_bytes": float64(20)},
+			},
+		},
+		"additional": map[string]interface{}{"metadata": map[string]interface{}{"platform": "linux"}},
+	}
+
+	delta := buildDelta(base, current)
+
+	if delta["uuid"] != "gw" || delta["batch_index"] != float64(2) {
+		t.Errorf("expected envelope fields in delta, got %v", delta)
+	}
+	if _, ok := delta["additional"]; ok {
+		t.Error("unchanged additional should be omitted")
+	}
+	if v, ok := delta["removed"]; !ok || v != nil {
+		t.Errorf("removed key should be null, got %v (present=%v)", v, ok)
+	}
+	memory := delta["stats"].(map[string]interface{})["compute"].(map[string]interface{})["memory"].(map[string]interface{})
+	if _, ok := memory["total_bytes"]; ok {
+		t.Error("unchanged total_bytes should be omitted")
+	}
+	if memory["used_bytes"] != float64(20) {
+		t.Errorf("expected used_bytes=20, got %v", memory["used_bytes"])
+	}
+	if _, ok := delta["stats"].(map[string]interface{})["system_status"]; ok {
+		t.Error("unchanged system_status should be omitted")
+	}
+}
+
+func TestBuildPayloadEnvironment(t *testing.T) {
+	sched := New(Config{
+		UUID:     "test-gateway-123",
+		ClientID: "test-client",
+		SiteID:   "test-site",
+		Platform: &platform.Info{
+			Platform:       platform.PlatformVM,
+			OS:             "linux",
+			Arch:           "amd64",
+			Virtualization: true,
+			Hypervisor:     platform.HypervisorKVM,
+			Container:      platform.ContainerDocker,
+			Cloud:          platform.CloudAWS,
+		},
+		HeartbeatSeconds: 60,
+		Collector:        collector.New(120),
+		Logger:           logging.New(logging.LevelInfo, nil, "test-uuid"),
+	})
+
+	metadata := sched.buildPayload().Additional.Metadata
+	if metadata.Hypervisor != platform.HypervisorKVM {
+		t.Errorf("expected hypervisor=kvm, got %q", metadata.Hypervisor)
+	}
+	if metadata.Container != platform.ContainerDocker {
+		t.Errorf("expected container=docker, got %q", metadata.Container)
+	}
+	if metadata.Cloud != platform.CloudAWS {
+		t.Errorf("expected cloud=aws, got %q", metadata.Cloud)
+	}
+	if metadata.WSL {
+		t.Error("expected wsl=false")
+	}
+}
+
+func TestDeltaModeSnapshots(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	sched := New(Config{
+		UUID:              "test-uuid",
+		ClientID:          "client",
+		SiteID:            "site",
+		Platform:          &platform.Info{Platform: platform.PlatformLinux},
+		HeartbeatSeconds:  60,
+		Collector:         collector.New(120),
+		Transport:         client,
+		Logger:            logging.New(logging.LevelError, nil, "test-uuid"),
+		PayloadMode:       PayloadModeDelta,
+		FullSnapshotEvery: 3,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if err := sched.SendOnce(ctx, false); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+	sched.RequestFullSnapshot()
+	if err := sched.SendOnce(ctx, false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	expectedModes := []string{PayloadModeFull, PayloadModeDelta, PayloadModeDelta, PayloadModeFull, PayloadModeFull}
+	if len(bodies) != len(expectedModes) {
+		t.Fatalf("expected %d bodies, got %d", len(expectedModes), len(bodies))
+	}
+	for i, mode := range expectedModes {
+		if bodies[i]["payload_mode"] != mode {
+			t.Errorf("body %d: expected payload_mode=%s, got %v", i, mode, bodies[i]["payload_mode"])
+		}
+	}
+
+	if bodies[1]["base_batch_index"] != float64(1) {
+		t.Errorf("expected first delta base_batch_index=1, got %v", bodies[1]["base_batch_index"])
+	}
+	if bodies[2]["base_batch_index"] != float64(2) {
+		t.Errorf("expected second delta base_batch_index=2, got %v", bodies[2]["base_batch_index"])
+	}
+	if additional, ok := bodies[2]["additional"].(map[string]interface{}); ok {
+		if _, ok := additional["metadata"]; ok {
+			t.Error("unchanged metadata should not be repeated in a delta")
+		}
+	}
+	if _, ok := bodies[0]["additional"]; !ok {
+		t.Error("full snapshot should include metadata")
+	}
+}
+
+func TestFullSnapshotRequestedInFlight(t *testing.T) {
+	var sched *Scheduler
+	var modes []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+		modes = append(modes, body["payload_mode"])
+		if len(modes) == 1 {
+			// The request arrives while the first full snapshot is in flight.
+			sched.RequestFullSnapshot()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	sched = New(Config{
+		UUID:              "test-uuid",
+		ClientID:          "client",
+		SiteID:            "site",
+		Platform:          &platform.Info{Platform: platform.PlatformLinux},
+		HeartbeatSeconds:  60,
+		Collector:         collector.New(120),
+		Transport:         client,
+		Logger:            logging.New(logging.LevelError, nil, "test-uuid"),
+		PayloadMode:       PayloadModeDelta,
+		FullSnapshotEvery: 10,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := sched.SendOnce(ctx, false); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+
+	expected := []interface{}{PayloadModeFull, PayloadModeFull, PayloadModeDelta}
+	for i, mode := range expected {
+		if modes[i] != mode {
+			t.Errorf("body %d: expected payload_mode=%v, got %v", i, mode, modes[i])
+		}
+	}
+}
+
+func TestPayloadIncludesSession(t *testing.T) {
+	var gotKey string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("Idempotency-Key")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	current := &session.Session{ID: "boot-abc", BootID: "boot", StartedAt: "2024-01-02T00:00:00Z"}
+	previous := &session.Record{
+		Session:        session.Session{ID: "boot-old", BootID: "boot", StartedAt: "2024-01-01T00:00:00Z"},
+		LastBatchIndex: 10,
+		CleanShutdown:  true,
+	}
+	sched := New(Config{
+		UUID:            "test-uuid",
+		ClientID:        "client",
+		SiteID:          "site",
+		Platform:        &platform.Info{Platform: platform.PlatformLinux},
+		Collector:       collector.New(120),
+		Transport:       client,
+		Logger:          logging.New(logging.LevelError, nil, "test-uuid"),
+		Session:         current,
+		PreviousSession: previous,
+	})
+
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if gotKey != "boot-abc-1" {
+		t.Errorf("expected Idempotency-Key boot-abc-1, got %q", gotKey)
+	}
+	sess, ok := body["session"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected session in payload, got %v", body["session"])
+	}
+	if sess["id"] != "boot-abc" {
+		t.Errorf("expected session id boot-abc, got %v", sess["id"])
+	}
+	prev, ok := sess["previous"].(map[string]interface{})
+	if !ok || prev["id"] != "boot-old" || prev["last_batch_index"] != float64(10) {
+		t.Errorf("unexpected previous session %v", sess["previous"])
+	}
+}
+
+func TestResponseDirectivesAppliedAndAcknowledged(t *testing.T) {
+	var bodies []map[string]interface{}
+	var auths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		auths = append(auths, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+		if len(bodies) == 1 {
+			w.Write([]byte(`{
+				"version": "1.0",
+				"directives": [
+					{"id": "d1", "type": "set_heartbeat_interval", "params": {"seconds": 30}},
+					{"id": "d2", "type": "set_log_level", "params": {"level": "debug", "duration_seconds": 60}},
+					{"id": "d3", "type": "rotate_token", "params": {"token": "new-token"}},
+					{"id": "d4", "type": "self_destruct"},
+					{"id": "d5", "type": "set_heartbeat_interval", "params": {"seconds": 1}}
+				]
+			}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "old-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	logger := logging.New(logging.LevelInfo, nil, "test-uuid")
+	sched := New(Config{
+		UUID:             "test-uuid",
+		ClientID:         "client",
+		SiteID:           "site",
+		Platform:         &platform.Info{Platform: platform.PlatformLinux},
+		HeartbeatSeconds: 15,
+		Collector:        collector.New(120),
+		Transport:        client,
+		Logger:           logger,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := sched.SendOnce(ctx, false); err != nil {
+			t.Fatalf("send %d failed: %v", i, err)
+		}
+	}
+
+	if sched.HeartbeatInterval() != 30*time.Second {
+		t.Errorf("expected heartbeat interval 30s, got %v", sched.HeartbeatInterval())
+	}
+	if logger.Level() != logging.LevelDebug {
+		t.Errorf("expected debug log level, got %v", logger.Level())
+	}
+	if auths[1] != "Bearer new-token" {
+		t.Errorf("expected rotated token on next send, got %q", auths[1])
+	}
+	if tokens := client.Tokens(); len(tokens) != 2 || tokens[1] != "old-token" {
+		t.Errorf("expected old token kept as grace, got %d tokens", len(tokens))
+	}
+
+	acks, ok := bodies[1]["directive_acks"].([]interface{})
+	if !ok || len(acks) != 5 {
+		t.Fatalf("expected 5 acks in second payload, got %v", bodies[1]["directive_acks"])
+	}
+	expected := []string{AckApplied, AckApplied, AckApplied, AckIgnored, AckRejected}
+	for i, status := range expected {
+		ack := acks[i].(map[string]interface{})
+		if ack["status"] != status {
+			t.Errorf("ack %d: expected %s, got %v", i, status, ack["status"])
+		}
+	}
+	if _, ok := bodies[2]["directive_acks"]; ok {
+		t.Error("acks should be cleared once delivered")
+	}
+}
+
+func TestUnsupportedResponseVersionIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"version":"2","directives":[{"id":"d1","type":"full_snapshot"}]}`))
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	sched := New(Config{
+		UUID:      "test-uuid",
+		ClientID:  "client",
+		SiteID:    "site",
+		Platform:  &platform.Info{Platform: platform.PlatformLinux},
+		Collector: collector.New(120),
+		Transport: client,
+		Logger:    logging.New(logging.LevelError, nil, "test-uuid"),
+	})
+
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(sched.pendingAcks) != 0 {
+		t.Errorf("expected no acks for unsupported version, got %d", len(sched.pendingAcks))
+	}
+}
+
+func TestBackendTokenRotation(t *testing.T) {
+	var auths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+		switch len(auths) {
+		case 1:
+			w.Write([]byte(`{"version":"1","directives":[{"id":"r1","type":"rotate_token","params":{"token":"new-token"}}]}`))
+		case 2:
+			w.Write([]byte(`{"version":"1","directives":[{"id":"c1","type":"confirm_token"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "config-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	dataDir := t.TempDir()
+	store, err := credentials.Open(dataDir, "config-token")
+	if err != nil {
+		t.Fatalf("failed to open token store: %v", err)
+	}
+
+	sched := New(Config{
+		UUID:        "test-uuid",
+		ClientID:    "client",
+		SiteID:      "site",
+		Platform:    &platform.Info{Platform: platform.PlatformLinux},
+		Collector:   collector.New(120),
+		Transport:   client,
+		Logger:      logging.New(logging.LevelError, nil, "test-uuid"),
+		TokenStore:  store,
+		ConfigToken: "config-token",
+	})
+
+	ctx := context.Background()
+	if err := sched.SendOnce(ctx, false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	pending := sched.buildPayload().Additional.Auth
+	if !pending.RotationPending || pending.TokenFingerprint != credentials.Fingerprint("new-token") {
+		t.Errorf("expected pending rotation to new token, got %+v", pending)
+	}
+	if pending.GraceFingerprint != credentials.Fingerprint("config-token") {
+		t.Error("expected config token kept as grace")
+	}
+
+	if err := sched.SendOnce(ctx, false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if auths[1] != "Bearer new-token" {
+		t.Errorf("expected new token after rotation, got %q", auths[1])
+	}
+
+	if tokens := client.Tokens(); len(tokens) != 1 {
+		t.Errorf("expected grace token dropped after confirm, got %d tokens", len(tokens))
+	}
+	confirmed := sched.buildPayload().Additional.Auth
+	if confirmed.RotationPending || confirmed.GraceFingerprint != "" {
+		t.Errorf("expected confirmed rotation, got %+v", confirmed)
+	}
+
+	reopened, err := credentials.Open(dataDir, "config-token")
+	if err != nil {
+		t.Fatalf("failed to reopen token store: %v", err)
+	}
+	if current, _, ok := reopened.Tokens(); !ok || current != "new-token" {
+		t.Error("expected rotated token to survive restart")
+	}
+}
+
+func TestConfirmTokenRejectedWhenGraceAuthenticated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer old-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"version":"1","directives":[{"id":"c1","type":"confirm_token"}]}`))
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "new-token",
+		TokenGrace:   "old-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	sched := New(Config{
+		UUID:      "test-uuid",
+		ClientID:  "client",
+		SiteID:    "site",
+		Platform:  &platform.Info{Platform: platform.PlatformLinux},
+		Collector: collector.New(120),
+		Transport: client,
+		Logger:    logging.New(logging.LevelError, nil, "test-uuid"),
+	})
+
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(client.Tokens()) != 2 {
+		t.Error("grace token must be kept when current token did not authenticate")
+	}
+	if len(sched.pendingAcks) != 1 || sched.pendingAcks[0].Status != AckRejected {
+		t.Errorf("expected rejected ack, got %+v", sched.pendingAcks)
+	}
+	if stats := client.Stats(); stats.TokenSlot != transport.TokenSlotGrace {
+		t.Errorf("expected grace token slot, got %s", stats.TokenSlot)
+	}
+}
+
+type fakeRemoteConfig struct {
+	fetches int
+	results []error
+}
+
+func (f *fakeRemoteConfig) RequestFetch()             { f.fetches++ }
+func (f *fakeRemoteConfig) HeartbeatResult(err error) { f.results = append(f.results, err) }
+func (f *fakeRemoteConfig) Status() *remoteconfig.Status {
+	return &remoteconfig.Status{Version: 4, Confirmed: len(f.results) > 0}
+}
+
+func TestRemoteConfigDirectiveAndStatus(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		if len(bodies) == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"version":"1","directives":[{"id":"f1","type":"fetch_config"}]}`))
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	remote := &fakeRemoteConfig{}
+	sched := New(Config{
+		UUID:         "test-uuid",
+		ClientID:     "client",
+		SiteID:       "site",
+		Platform:     &platform.Info{Platform: platform.PlatformLinux},
+		Collector:    collector.New(120),
+		Transport:    client,
+		Logger:       logging.New(logging.LevelError, nil, "test-uuid"),
+		RemoteConfig: remote,
+	})
+
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if remote.fetches != 1 {
+		t.Errorf("expected fetch_config to request a fetch, got %d", remote.fetches)
+	}
+	if len(sched.pendingAcks) != 1 || sched.pendingAcks[0].Status != AckApplied {
+		t.Errorf("expected applied ack, got %+v", sched.pendingAcks)
+	}
+	status, ok := bodies[0]["additional"].(map[string]interface{})["remote_config"].(map[string]interface{})
+	if !ok || status["version"] != float64(4) {
+		t.Errorf("expected remote_config status in payload, got %v", bodies[0]["additional"])
+	}
+
+	// The failed heartbeat is reported too.
+	if err := sched.SendOnce(context.Background(), false); err == nil {
+		t.Fatal("expected send to fail")
+	}
+	if len(remote.results) != 2 || remote.results[0] != nil || remote.results[1] == nil {
+		t.Errorf("expected success then failure reported, got %v", remote.results)
+	}
+
+	// Without remote config the directive is rejected.
+	sched.config.RemoteConfig = nil
+	if ack := sched.applyDirective(Directive{ID: "f2", Type: DirectiveFetchConfig}, transport.TokenSlotCurrent); ack.Status != AckRejected {
+		t.Errorf("expected rejected ack without remote config, got %+v", ack)
+	}
+}
+
+func TestLogEntriesSentUntilAcknowledged(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		if len(bodies) == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	// The logger writes nothing to stdout; entries only reach the buffer.
+	logger := logging.New(logging.LevelInfo, io.Discard, "test-uuid")
+	recent := logging.NewRecent(10)
+	logger.AddSink(recent)
+	sched := New(Config{
+		UUID:       "test-uuid",
+		ClientID:   "client",
+		SiteID:     "site",
+		Platform:   &platform.Info{Platform: platform.PlatformLinux},
+		Collector:  collector.New(120),
+		Transport:  client,
+		Logger:     logger,
+		RecentLogs: recent,
+	})
+
+	logEntries := func(i int) []interface{} {
+		entries, _ := bodies[i]["log_entries"].([]interface{})
+		return entries
+	}
+
+	logger.Warn("Disk nearly full", map[string]interface{}{"percent": 91})
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if entries := logEntries(0); len(entries) != 1 || entries[0].(map[string]interface{})["msg"] != "Disk nearly full" {
+		t.Fatalf("expected the warning in the first payload, got %v", entries)
+	}
+
+	// Acknowledged entries are not sent again; the failed send's entries
+	// are, along with the error it logged.
+	logger.Warn("Disk nearly full", map[string]interface{}{"percent": 93})
+	if err := sched.SendOnce(context.Background(), false); err == nil {
+		t.Fatal("expected send to fail")
+	}
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	entries := logEntries(2)
+	if len(entries) != 2 {
+		t.Fatalf("expected the repeated warning and the send error, got %v", entries)
+	}
+	warning := entries[0].(map[string]interface{})
+	if warning["count"] != float64(2) || warning["fields"].(map[string]interface{})["percent"] != "93" {
+		t.Errorf("expected folded warning with latest fields, got %v", warning)
+	}
+	if entries[1].(map[string]interface{})["msg"] != "Failed to send heartbeat" {
+		t.Errorf("expected the send error, got %v", entries[1])
+	}
+
+	if err := sched.SendOnce(context.Background(), false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if entries := logEntries(3); len(entries) != 0 {
+		t.Errorf("expected no entries once acknowledged, got %v", entries)
+	}
+}
+
+func TestIdentitySentOnStartupAndOnChange(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		if len(bodies) == 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := transport.New(transport.Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	identity := platform.Identity{OSID: "ubuntu", OSVersionID: "22.04", Hostname: "gw-01"}
+	sched := New(Config{
+		UUID:         "test-uuid",
+		ClientID:     "client",
+		SiteID:       "site",
+		Platform:     &platform.Info{Platform: platform.PlatformUbuntu, Identity: identity},
+		Collector:    collector.New(120),
+		Transport:    client,
+		Logger:       logging.New(logging.LevelInfo, io.Discard, "test-uuid"),
+		ReadIdentity: func() platform.Identity { return identity },
+	})
+
+	hostname := func(i int) interface{} {
+		metadata := bodies[i]["additional"].(map[string]interface{})["metadata"].(map[string]interface{})
+		id, ok := metadata["identity"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		return id["hostname"]
+	}
+	send := func() { sched.SendOnce(context.Background(), false) }
+
+	send()
+	send()
+	if hostname(0) != "gw-01" || hostname(1) != nil {
+		t.Fatalf("expected identity only until acknowledged, got %v then %v", hostname(0), hostname(1))
+	}
+
+	// A change is sent until the backend acknowledges it.
+	identity.Hostname = "gw-02"
+	send()
+	send()
+	send()
+	if hostname(2) != "gw-02" || hostname(3) != "gw-02" || hostname(4) != nil {
+		t.Errorf("expected changed identity until acknowledged, got %v, %v, %v", hostname(2), hostname(3), hostname(4))
+	}
+}
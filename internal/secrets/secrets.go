@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandTimeout bounds how long a secret command may run.
+const CommandTimeout = 10 * time.Second
+
+// Source describes where a secret comes from. At most one of File, Env and
+// Command should be set; when none is, Value is used as a literal.
+type Source struct {
+	// Name identifies the secret in errors, e.g. "auth.token_current".
+	Name    string
+	Value   string
+	File    string
+	Env     string
+	Command []string
+}
+
+// Count returns how many of the mutually exclusive sources are set.
+func (s Source) Count() int {
+	n := 0
+	if s.Value != "" {
+		n++
+	}
+	if s.File != "" {
+		n++
+	}
+	if s.Env != "" {
+		n++
+	}
+	if len(s.Command) > 0 {
+		n++
+	}
+	return n
+}
+
+// External reports whether the secret is read from outside the config file.
+func (s Source) External() bool {
+	return s.File != "" || s.Env != "" || len(s.Command) > 0
+}
+
+// Resolve returns the secret with surrounding whitespace trimmed. A source
+// with nothing configured resolves to the empty string.
+func (s Source) Resolve(ctx context.Context) (string, error) {
+	var value string
+	switch {
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to read %s: %w", s.Name, s.File, err)
+		}
+		value = string(data)
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", s.Name, s.Env)
+		}
+		value = v
+	case len(s.Command) > 0:
+		v, err := runCommand(ctx, s.Command)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", s.Name, err)
+		}
+		value = v
+	default:
+		return s.Value, nil
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%s: resolved to an empty value", s.Name)
+	}
+	return value, nil
+}
+
+func runCommand(ctx context.Context, argv []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// stdout may hold a partial secret; only stderr is reported.
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		if msg != "" {
+			return "", fmt.Errorf("command %s failed: %v: %s", argv[0], err, msg)
+		}
+		return "", fmt.Errorf("command %s failed: %v", argv[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// Watcher re-resolves a set of sources so secrets can change without a
+// restart. Files are only re-read when their size or modification time
+// changes; environment variables and commands are resolved on every
+// refresh.
+type Watcher struct {
+	mu      sync.Mutex
+	sources []Source
+	values  []string
+	stamps  []fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewWatcher returns a watcher whose initial values are the given, already
+// resolved values, one per source.
+func NewWatcher(sources []Source, values []string) *Watcher {
+	w := &Watcher{
+		sources: sources,
+		values:  append([]string(nil), values...),
+		stamps:  make([]fileStamp, len(sources)),
+	}
+	for i, src := range sources {
+		if src.File != "" {
+			w.stamps[i], _ = stat(src.File)
+		}
+	}
+	return w
+}
+
+// Refresh re-resolves every source and reports whether any value changed.
+// On error the previous values are kept.
+func (w *Watcher) Refresh(ctx context.Context) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	values := append([]string(nil), w.values...)
+	stamps := append([]fileStamp(nil), w.stamps...)
+	for i, src := range w.sources {
+		if src.File != "" {
+			stamp, err := stat(src.File)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", src.Name, err)
+			}
+			if stamp == stamps[i] {
+				continue
+			}
+			stamps[i] = stamp
+		}
+		v, err := src.Resolve(ctx)
+		if err != nil {
+			return false, err
+		}
+		values[i] = v
+	}
+
+	changed := false
+	for i := range values {
+		if values[i] != w.values[i] {
+			changed = true
+		}
+	}
+	w.values = values
+	w.stamps = stamps
+	return changed, nil
+}
+
+// Values returns the current values in source order.
+func (w *Watcher) Values() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.values...)
+}
+
+func stat(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
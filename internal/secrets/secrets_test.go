@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveSources(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("  from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GW_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		name   string
+		source Source
+		want   string
+		err    bool
+	}{
+		{name: "literal", source: Source{Value: "literal"}, want: "literal"},
+		{name: "file", source: Source{File: path}, want: "from-file"},
+		{name: "env", source: Source{Env: "GW_TEST_SECRET"}, want: "from-env"},
+		{name: "command", source: Source{Command: []string{"echo", "from-command"}}, want: "from-command"},
+		{name: "missing file", source: Source{File: filepath.Join(dir, "missing")}, err: true},
+		{name: "unset env", source: Source{Env: "GW_TEST_UNSET_SECRET"}, err: true},
+		{name: "failing command", source: Source{Command: []string{"false"}}, err: true},
+		{name: "empty command output", source: Source{Command: []string{"true"}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Resolve(context.Background())
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWatcherDetectsFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher([]Source{{Name: "token", File: path}}, []string{"old"})
+
+	changed, err := w.Refresh(context.Background())
+	if err != nil || changed {
+		t.Fatalf("expected no change, got changed=%v err=%v", changed, err)
+	}
+
+	if err := os.WriteFile(path, []byte("new-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	changed, err = w.Refresh(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("expected change, got changed=%v err=%v", changed, err)
+	}
+	if got := w.Values()[0]; got != "new-token" {
+		t.Errorf("expected new-token, got %q", got)
+	}
+
+	os.Remove(path)
+	if _, err := w.Refresh(context.Background()); err == nil {
+		t.Error("expected error for removed file")
+	}
+	if got := w.Values()[0]; got != "new-token" {
+		t.Errorf("expected previous value kept on error, got %q", got)
+	}
+}
@@ -0,0 +1,120 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/binary-gws/agent/internal/fileutil"
+)
+
+const FileName = "session.json"
+
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// Session identifies one run of the agent process. Together with the
+// payload batch_index it forms a key that is unique across restarts.
+type Session struct {
+	ID        string `json:"id"`
+	BootID    string `json:"boot_id,omitempty"`
+	StartedAt string `json:"started_at"`
+}
+
+// Record is what is persisted between runs. EndedAt and LastBatchIndex are
+// only set when the previous process shut down cleanly.
+type Record struct {
+	Session
+	EndedAt        string `json:"ended_at,omitempty"`
+	LastBatchIndex int    `json:"last_batch_index,omitempty"`
+	CleanShutdown  bool   `json:"clean_shutdown"`
+}
+
+// New starts a session with a random ID prefixed by the kernel boot ID when
+// one is available.
+func New() (*Session, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	s := &Session{
+		BootID:    readBootID(),
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	s.ID = hex.EncodeToString(random)
+	if s.BootID != "" {
+		s.ID = s.BootID + "-" + s.ID
+	}
+	return s, nil
+}
+
+// IdempotencyKey returns the key for the heartbeat with batchIndex. Retries
+// of the same heartbeat reuse it.
+func (s *Session) IdempotencyKey(batchIndex int) string {
+	return fmt.Sprintf("%s-%d", s.ID, batchIndex)
+}
+
+func readBootID() string {
+	data, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Store persists session records in dir.
+type Store struct {
+	path string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{path: filepath.Join(dir, FileName)}
+}
+
+// Load returns the stored record, or nil if none exists yet.
+func (st *Store) Load() (*Record, error) {
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session state: %w", err)
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse session state: %w", err)
+	}
+	return &rec, nil
+}
+
+// Start records s as the running session.
+func (st *Store) Start(s *Session) error {
+	return st.save(&Record{Session: *s})
+}
+
+// End records a clean shutdown of s after lastBatchIndex heartbeats.
+func (st *Store) End(s *Session, lastBatchIndex int) error {
+	return st.save(&Record{
+		Session:        *s,
+		EndedAt:        time.Now().UTC().Format(time.RFC3339),
+		LastBatchIndex: lastBatchIndex,
+		CleanShutdown:  true,
+	})
+}
+
+func (st *Store) save(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFileAtomic(st.path, data); err != nil {
+		return fmt.Errorf("failed to write session state: %w", err)
+	}
+	return nil
+}
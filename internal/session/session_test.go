@@ -0,0 +1,72 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewSessionIncludesBootID(t *testing.T) {
+	dir := t.TempDir()
+	bootIDPath = filepath.Join(dir, "boot_id")
+	defer func() { bootIDPath = "/proc/sys/kernel/random/boot_id" }()
+
+	if err := os.WriteFile(bootIDPath, []byte("boot-1234\n"), 0644); err != nil {
+		t.Fatalf("failed to write boot id: %v", err)
+	}
+
+	s1, err := New()
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	s2, err := New()
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	if s1.BootID != "boot-1234" {
+		t.Errorf("expected boot id boot-1234, got %s", s1.BootID)
+	}
+	if !strings.HasPrefix(s1.ID, "boot-1234-") {
+		t.Errorf("expected session id prefixed with boot id, got %s", s1.ID)
+	}
+	if s1.ID == s2.ID {
+		t.Error("expected distinct session ids")
+	}
+	if s1.IdempotencyKey(7) != s1.ID+"-7" {
+		t.Errorf("unexpected idempotency key %s", s1.IdempotencyKey(7))
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "state"))
+
+	rec, err := store.Load()
+	if err != nil || rec != nil {
+		t.Fatalf("expected no record on first run, got %v, %v", rec, err)
+	}
+
+	s := &Session{ID: "abc", BootID: "boot", StartedAt: "2024-01-01T00:00:00Z"}
+	if err := store.Start(s); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	rec, err = store.Load()
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if rec.ID != "abc" || rec.CleanShutdown {
+		t.Errorf("unexpected record after start: %+v", rec)
+	}
+
+	if err := store.End(s, 42); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	rec, err = store.Load()
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if !rec.CleanShutdown || rec.LastBatchIndex != 42 || rec.EndedAt == "" {
+		t.Errorf("unexpected record after end: %+v", rec)
+	}
+}
@@ -0,0 +1,26 @@
+// Package testutil holds helpers shared by tests of several packages.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FixtureRoot writes files, keyed by slash-separated path relative to the
+// root, into a temporary directory and returns it. Code that reads /proc,
+// /sys or /etc relative to a root can then run against the fixture.
+func FixtureRoot(t testing.TB, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+const DefaultCompressionMinBytes = 1024
+
+// ValidEncoding reports whether name is a supported request body encoding.
+// An empty name and "none" both mean identity.
+func ValidEncoding(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "none", EncodingIdentity, EncodingGzip, EncodingZstd:
+		return true
+	}
+	return false
+}
+
+func normalizeEncoding(name string) string {
+	switch strings.ToLower(name) {
+	case EncodingGzip:
+		return EncodingGzip
+	case EncodingZstd:
+		return EncodingZstd
+	default:
+		return EncodingIdentity
+	}
+}
+
+// encodingFor returns the encoding to use for a body of size bytes sent to
+// apiURL, honoring any downgrade negotiated after a 415 response.
+func (c *Client) encodingFor(apiURL string, size int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	encoding := normalizeEncoding(c.config.Compression)
+	if encoding == EncodingIdentity || size < c.config.CompressionMinBytes {
+		return EncodingIdentity
+	}
+	if negotiated, ok := c.negotiatedEncodings[apiURL]; ok {
+		return negotiated
+	}
+	return encoding
+}
+
+// downgradeEncoding records that apiURL rejected rejected and returns the
+// encoding to retry with. The server's Accept-Encoding header (RFC 7694) is
+// consulted first; anything else falls back to identity.
+func (c *Client) downgradeEncoding(apiURL, rejected, acceptEncoding string) string {
+	next := EncodingIdentity
+	if rejected == EncodingZstd && acceptsEncoding(acceptEncoding, EncodingGzip) {
+		next = EncodingGzip
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.negotiatedEncodings[apiURL] = next
+	return next
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), encoding) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			if strings.ReplaceAll(strings.TrimSpace(param), " ", "") == "q=0" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func encodeBody(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		defer w.Close()
+		return w.EncodeAll(data, nil), nil
+	default:
+		return data, nil
+	}
+}
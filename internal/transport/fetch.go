@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Fetch GETs rawURL with the same credentials, signing and TLS settings as
+// heartbeats, including the SPKI pins of the api urls on its host. It falls
+// back to the grace token on 401/403 but does not retry otherwise; callers
+// poll again later. A 2xx or 304 is returned as a Response, anything else
+// as an error.
+func (c *Client) Fetch(ctx context.Context, rawURL string, header http.Header) (*Response, error) {
+	tokens := c.Tokens()
+	httpClient, err := c.fetchClientFor(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	signer := c.config.Signer
+	c.mu.Unlock()
+
+	var lastErr error
+	for tokenIndex, token := range tokens {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if signer != nil {
+			if err := signRequest(req, signer, nil, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		tokenSlot := TokenSlotCurrent
+		if tokenIndex > 0 {
+			tokenSlot = TokenSlotGrace
+		}
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300, resp.StatusCode == http.StatusNotModified:
+			return &Response{StatusCode: resp.StatusCode, Body: body, TokenSlot: tokenSlot}, nil
+		case resp.StatusCode == 401 || resp.StatusCode == 403:
+			lastErr = fmt.Errorf("authentication failed: HTTP %d", resp.StatusCode)
+			continue
+		default:
+			return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,93 @@
+package transport
+
+import "time"
+
+// Stats describes the most recent successful send, with counters since the
+// client was created in Totals.
+type Stats struct {
+	EndpointIndex     int    `json:"endpoint_index"`
+	TokenSlot         string `json:"token_slot"`
+	Attempts          int    `json:"attempts"`
+	Retries           int    `json:"retries"`
+	Fallbacks         int    `json:"fallbacks"`
+	LatencyMs         int64  `json:"latency_ms"`
+	ContentEncoding   string `json:"content_encoding"`
+	UncompressedBytes int    `json:"uncompressed_bytes"`
+	SentBytes         int    `json:"sent_bytes"`
+
+	Totals Counters `json:"totals"`
+}
+
+// Counters accumulate over every send since startup, successful or not.
+type Counters struct {
+	Sends             int64 `json:"sends"`
+	Failures          int64 `json:"failures"`
+	Attempts          int64 `json:"attempts"`
+	Retries           int64 `json:"retries"`
+	Fallbacks         int64 `json:"fallbacks"`
+	GraceTokenSends   int64 `json:"grace_token_sends"`
+	FallbackURLSends  int64 `json:"fallback_url_sends"`
+	UncompressedBytes int64 `json:"uncompressed_bytes"`
+	SentBytes         int64 `json:"sent_bytes"`
+}
+
+// sendTrace collects what happened during one SendHeartbeat call.
+type sendTrace struct {
+	endpointIndex int
+	tokenSlot     string
+	attempts      int
+	retries       int
+	fallbacks     int
+	latency       time.Duration
+	encoding      string
+	uncompressed  int
+	sent          int
+}
+
+// Stats returns send statistics, or nil before the first successful send.
+func (c *Client) Stats() *Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.hasStats {
+		return nil
+	}
+	stats := c.stats
+	stats.Totals = c.totals
+	return &stats
+}
+
+func (c *Client) recordSend(trace *sendTrace, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.totals.Attempts += int64(trace.attempts)
+	c.totals.Retries += int64(trace.retries)
+	c.totals.Fallbacks += int64(trace.fallbacks)
+	if err != nil {
+		c.totals.Failures++
+		return
+	}
+
+	c.totals.Sends++
+	if trace.tokenSlot == TokenSlotGrace {
+		c.totals.GraceTokenSends++
+	}
+	if trace.endpointIndex > 0 {
+		c.totals.FallbackURLSends++
+	}
+	c.totals.UncompressedBytes += int64(trace.uncompressed)
+	c.totals.SentBytes += int64(trace.sent)
+
+	c.hasStats = true
+	c.stats = Stats{
+		EndpointIndex:     trace.endpointIndex,
+		TokenSlot:         trace.tokenSlot,
+		Attempts:          trace.attempts,
+		Retries:           trace.retries,
+		Fallbacks:         trace.fallbacks,
+		LatencyMs:         trace.latency.Milliseconds(),
+		ContentEncoding:   trace.encoding,
+		UncompressedBytes: trace.uncompressed,
+		SentBytes:         trace.sent,
+	}
+}
@@ -3,17 +3,29 @@ package transport
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+// ErrPinMismatch is returned when an endpoint's certificate does not match
+// its configured SPKI pins. It is never retried, and no fallback URL is tried
+// after it.
+var ErrPinMismatch = errors.New("tls certificate pin mismatch")
+
 type Config struct {
 	APIURLs            []string
 	TokenCurrent       string
@@ -21,11 +33,29 @@ type Config struct {
 	CABundlePath       string
 	InsecureSkipVerify bool
 	RequestTimeout     time.Duration
+	// SPKIPins maps an entry of APIURLs to the base64 SHA-256 SPKI hashes
+	// accepted for it. Listing a backup pin allows key rotation.
+	SPKIPins map[string][]string
+	// Compression selects the request body encoding: identity, gzip or zstd.
+	// Bodies smaller than CompressionMinBytes are always sent as identity;
+	// zero means DefaultCompressionMinBytes.
+	Compression         string
+	CompressionMinBytes int
+	// Signer, when set, signs every request body with the device key.
+	Signer Signer
 }
 
 type Client struct {
-	config     Config
-	httpClient *http.Client
+	config        Config
+	httpClient    *http.Client
+	pinnedClients map[string]*http.Client
+	fetchClients  map[string]*http.Client
+
+	mu                  sync.Mutex
+	negotiatedEncodings map[string]string
+	stats               Stats
+	hasStats            bool
+	totals              Counters
 }
 
 type RetryConfig struct {
@@ -49,19 +79,91 @@ func (RealSleeper) Sleep(d time.Duration) {
 }
 
 func New(cfg Config) (*Client, error) {
+	httpClient, pinnedClients, err := buildHTTPClients(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		config:              cfg,
+		httpClient:          httpClient,
+		pinnedClients:       pinnedClients,
+		fetchClients:        make(map[string]*http.Client),
+		negotiatedEncodings: make(map[string]string),
+	}, nil
+}
+
+// Reconfigure applies new endpoints, TLS and compression settings from the
+// next heartbeat on. Tokens, the signer and send statistics are kept; use
+// SetTokens to change tokens.
+func (c *Client) Reconfigure(cfg Config) error {
+	httpClient, pinnedClients, err := buildHTTPClients(&cfg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.httpClient
+	oldFetchClients := c.fetchClients
+	cfg.TokenCurrent = c.config.TokenCurrent
+	cfg.TokenGrace = c.config.TokenGrace
+	cfg.Signer = c.config.Signer
+	c.config = cfg
+	c.httpClient = httpClient
+	c.pinnedClients = pinnedClients
+	c.fetchClients = make(map[string]*http.Client)
+	c.negotiatedEncodings = make(map[string]string)
+	c.mu.Unlock()
+
+	old.CloseIdleConnections()
+	for _, fetchClient := range oldFetchClients {
+		fetchClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// buildHTTPClients applies defaults to cfg, validates it and returns the
+// default and per-endpoint pinned HTTP clients.
+func buildHTTPClients(cfg *Config) (*http.Client, map[string]*http.Client, error) {
 	if cfg.RequestTimeout == 0 {
 		cfg.RequestTimeout = 10 * time.Second
 	}
 	if len(cfg.APIURLs) == 0 {
-		return nil, fmt.Errorf("api_urls is required")
+		return nil, nil, fmt.Errorf("api_urls is required")
+	}
+	if !ValidEncoding(cfg.Compression) {
+		return nil, nil, fmt.Errorf("unsupported compression %q", cfg.Compression)
+	}
+	if cfg.CompressionMinBytes == 0 {
+		cfg.CompressionMinBytes = DefaultCompressionMinBytes
+	}
+
+	tlsConfig, err := NewTLSConfig(cfg.CABundlePath, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	pinnedClients := make(map[string]*http.Client)
+	for pinnedURL, urlPins := range cfg.SPKIPins {
+		pins, err := parsePins(cfg.APIURLs, pinnedURL, urlPins)
+		if err != nil {
+			return nil, nil, err
+		}
+		pinnedClients[pinnedURL] = NewHTTPClient(pinTLSConfig(tlsConfig, pinnedURL, pins), cfg.RequestTimeout)
+	}
+
+	return NewHTTPClient(tlsConfig, cfg.RequestTimeout), pinnedClients, nil
+}
+
+// NewTLSConfig builds the TLS settings shared by every request the agent
+// makes to the backend.
+func NewTLSConfig(caBundlePath string, insecureSkipVerify bool) (*tls.Config, error) {
 	tlsConfig := &tls.Config{
-		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		InsecureSkipVerify: insecureSkipVerify,
 	}
 
-	if cfg.CABundlePath != "" {
-		caCert, err := os.ReadFile(cfg.CABundlePath)
+	if caBundlePath != "" {
+		caCert, err := os.ReadFile(caBundlePath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
 		}
@@ -71,9 +173,56 @@ func New(cfg Config) (*Client, error) {
 		}
 		tlsConfig.RootCAs = caCertPool
 	}
+	return tlsConfig, nil
+}
+
+// NewPinnedTLSConfig builds the TLS settings for a request to rawURL outside
+// the heartbeat path, such as enrollment. The SPKI pins of every api url
+// with the same scheme and host are accepted, so no request to a pinned
+// backend goes out unpinned.
+func NewPinnedTLSConfig(caBundlePath string, insecureSkipVerify bool, spkiPins map[string][]string, rawURL string) (*tls.Config, error) {
+	tlsConfig, err := NewTLSConfig(caBundlePath, insecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %w", rawURL, err)
+	}
+
+	var pins []string
+	for _, pinnedURL := range slices.Sorted(maps.Keys(spkiPins)) {
+		parsedURL, err := url.Parse(pinnedURL)
+		if err != nil || !strings.EqualFold(parsedURL.Scheme, target.Scheme) || !strings.EqualFold(parsedURL.Host, target.Host) {
+			continue
+		}
+		urlPins, err := decodePins(spkiPins[pinnedURL])
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, urlPins...)
+	}
+	if len(pins) == 0 {
+		return tlsConfig, nil
+	}
+	return pinTLSConfig(tlsConfig, rawURL, pins), nil
+}
+
+// pinTLSConfig returns a copy of tlsConfig that only accepts target when its
+// certificate matches one of the decoded pins.
+func pinTLSConfig(tlsConfig *tls.Config, target string, pins []string) *tls.Config {
+	pinned := tlsConfig.Clone()
+	pinned.VerifyConnection = func(cs tls.ConnectionState) error {
+		return verifyPins(cs, target, pins)
+	}
+	return pinned
+}
 
-	httpClient := &http.Client{
-		Timeout: cfg.RequestTimeout,
+// NewHTTPClient returns an HTTP client using tlsConfig. It is also used for
+// requests outside the heartbeat path such as enrollment.
+func NewHTTPClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
 		Transport: &http.Transport{
 			TLSClientConfig:     tlsConfig,
 			MaxIdleConns:        10,
@@ -83,44 +232,209 @@ func New(cfg Config) (*Client, error) {
 			MaxIdleConnsPerHost: 2,
 		},
 	}
+}
 
-	return &Client{
-		config:     cfg,
-		httpClient: httpClient,
-	}, nil
+// clientFor returns the HTTP client for apiURL; pinned endpoints get their
+// own transport so the pin check cannot leak to other hosts.
+func (c *Client) clientFor(apiURL string) *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pinned, ok := c.pinnedClients[apiURL]; ok {
+		return pinned
+	}
+	return c.httpClient
+}
+
+// fetchClientFor returns the HTTP client for a Fetch of rawURL. A URL that
+// is not itself an api url gets a client pinned like the api urls on its
+// host, built on first use.
+func (c *Client) fetchClientFor(rawURL string) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pinned, ok := c.pinnedClients[rawURL]; ok {
+		return pinned, nil
+	}
+	if fetchClient, ok := c.fetchClients[rawURL]; ok {
+		return fetchClient, nil
+	}
+	tlsConfig, err := NewPinnedTLSConfig(c.config.CABundlePath, c.config.InsecureSkipVerify, c.config.SPKIPins, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	fetchClient := NewHTTPClient(tlsConfig, c.config.RequestTimeout)
+	c.fetchClients[rawURL] = fetchClient
+	return fetchClient, nil
+}
+
+// SendOptions carries per-heartbeat request metadata.
+type SendOptions struct {
+	// IdempotencyKey is sent as the Idempotency-Key header on every attempt
+	// of this heartbeat, including retries and fallback endpoints.
+	IdempotencyKey string
+}
+
+const (
+	TokenSlotCurrent = "current"
+	TokenSlotGrace   = "grace"
+)
+
+// Response is the backend's reply to a successful heartbeat.
+type Response struct {
+	StatusCode int
+	Body       []byte
+	// TokenSlot is the token that authenticated the request.
+	TokenSlot string
 }
 
 func (c *Client) SendHeartbeat(ctx context.Context, payload interface{}, retryConfig RetryConfig, sleeper Sleeper) error {
+	_, err := c.SendHeartbeatWithOptions(ctx, payload, SendOptions{}, retryConfig, sleeper)
+	return err
+}
+
+func (c *Client) SendHeartbeatWithOptions(ctx context.Context, payload interface{}, opts SendOptions, retryConfig RetryConfig, sleeper Sleeper) (*Response, error) {
 	if sleeper == nil {
 		sleeper = RealSleeper{}
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	tokens := []string{c.config.TokenCurrent}
-	if c.config.TokenGrace != "" {
-		tokens = append(tokens, c.config.TokenGrace)
-	}
+	tokens := c.Tokens()
+	trace := &sendTrace{uncompressed: len(jsonData)}
+
+	c.mu.Lock()
+	apiURLs := c.config.APIURLs
+	signer := c.config.Signer
+	c.mu.Unlock()
 
 	var lastErr error
-	for _, apiURL := range c.config.APIURLs {
+	for i, apiURL := range apiURLs {
 		if apiURL == "" {
 			continue
 		}
-		err := c.sendToURL(ctx, apiURL, jsonData, tokens, retryConfig, sleeper)
+		if lastErr != nil {
+			trace.fallbacks++
+		}
+		trace.endpointIndex = i
+		resp, err := c.sendToURL(ctx, apiURL, jsonData, tokens, signer, opts, retryConfig, sleeper, trace)
 		if err == nil {
-			return nil
+			c.recordSend(trace, nil)
+			return resp, nil
 		}
 		if !shouldTryFallback(err) {
-			return err
+			c.recordSend(trace, err)
+			return nil, err
 		}
 		lastErr = err
 	}
 
-	return lastErr
+	c.recordSend(trace, lastErr)
+	return nil, lastErr
+}
+
+// Tokens returns the current token followed by the grace token, if any.
+func (c *Client) Tokens() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tokens := []string{c.config.TokenCurrent}
+	if c.config.TokenGrace != "" {
+		tokens = append(tokens, c.config.TokenGrace)
+	}
+	return tokens
+}
+
+// SetTokens replaces the bearer tokens used from the next heartbeat on.
+func (c *Client) SetTokens(current, grace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config.TokenCurrent = current
+	c.config.TokenGrace = grace
+}
+
+// ParsePin decodes a base64 SHA-256 SPKI pin, with or without the
+// "sha256/" prefix.
+func ParsePin(pin string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid spki pin %q: %w", pin, err)
+	}
+	if len(raw) != sha256.Size {
+		return nil, fmt.Errorf("invalid spki pin %q: expected %d bytes, got %d", pin, sha256.Size, len(raw))
+	}
+	return raw, nil
+}
+
+// SPKIPin returns the pin for a certificate's public key in the form
+// accepted by Config.SPKIPins.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func parsePins(apiURLs []string, pinnedURL string, urlPins []string) ([]string, error) {
+	found := false
+	for _, apiURL := range apiURLs {
+		if apiURL == pinnedURL {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("spki pins configured for unknown api url %s", pinnedURL)
+	}
+	parsedURL, err := url.Parse(pinnedURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api url %s: %w", pinnedURL, err)
+	}
+	if !strings.EqualFold(parsedURL.Scheme, "https") {
+		return nil, fmt.Errorf("spki pins require an https api url, got %s", pinnedURL)
+	}
+	if len(urlPins) == 0 {
+		return nil, fmt.Errorf("spki pins for %s are empty", pinnedURL)
+	}
+	return decodePins(urlPins)
+}
+
+// decodePins normalises pins to the plain base64 form SPKIPin returns.
+func decodePins(urlPins []string) ([]string, error) {
+	pins := make([]string, 0, len(urlPins))
+	for _, pin := range urlPins {
+		raw, err := ParsePin(pin)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, base64.StdEncoding.EncodeToString(raw))
+	}
+	return pins, nil
+}
+
+// verifyPins accepts the leaf certificate or any certificate of a verified
+// chain. Other presented certificates are ignored: nothing vouches for them,
+// so a server could append any certificate it likes.
+func verifyPins(cs tls.ConnectionState, apiURL string, pins []string) error {
+	var certs []*x509.Certificate
+	if len(cs.PeerCertificates) > 0 {
+		certs = append(certs, cs.PeerCertificates[0])
+	}
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	for _, cert := range certs {
+		got := SPKIPin(cert)
+		for _, pin := range pins {
+			if got == pin {
+				return nil
+			}
+		}
+	}
+
+	presented := ""
+	if len(cs.PeerCertificates) > 0 {
+		presented = SPKIPin(cs.PeerCertificates[0])
+	}
+	return fmt.Errorf("%w: %s presented %s", ErrPinMismatch, apiURL, presented)
 }
 
 func extractStatusCode(err error) int {
@@ -145,6 +459,11 @@ func shouldTryFallback(err error) bool {
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		return false
 	}
+	// A pin mismatch may mean the traffic is being intercepted; the request
+	// is not offered to another endpoint.
+	if errors.Is(err, ErrPinMismatch) {
+		return false
+	}
 	statusCode := extractStatusCode(err)
 	if statusCode >= 400 && statusCode < 500 {
 		return false
@@ -152,20 +471,29 @@ func shouldTryFallback(err error) bool {
 	return true
 }
 
-func (c *Client) sendToURL(ctx context.Context, apiURL string, jsonData []byte, tokens []string, retryConfig RetryConfig, sleeper Sleeper) error {
+func (c *Client) sendToURL(ctx context.Context, apiURL string, jsonData []byte, tokens []string, signer Signer, opts SendOptions, retryConfig RetryConfig, sleeper Sleeper, trace *sendTrace) (*Response, error) {
+	encoding := c.encodingFor(apiURL, len(jsonData))
+	payloadBody, err := encodeBody(jsonData, encoding)
+	if err != nil {
+		return nil, err
+	}
+
 	var lastErr error
 	for tokenIndex, token := range tokens {
+		skipDelay := false
 		for attempt := 0; attempt <= retryConfig.MaxRetries; attempt++ {
-			if attempt > 0 {
+			if attempt > 0 && !skipDelay {
 				delayIndex := attempt - 1
 				if delayIndex >= len(retryConfig.Delays) {
 					delayIndex = len(retryConfig.Delays) - 1
 				}
 				delay := retryConfig.Delays[delayIndex]
 				sleeper.Sleep(delay)
+				trace.retries++
 			}
+			skipDelay = false
 
-			req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+			req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(payloadBody))
 			if err != nil {
 				lastErr = fmt.Errorf("failed to create request: %w", err)
 				continue
@@ -173,34 +501,72 @@ func (c *Client) sendToURL(ctx context.Context, apiURL string, jsonData []byte,
 
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Authorization", "Bearer "+token)
+			if encoding != EncodingIdentity {
+				req.Header.Set("Content-Encoding", encoding)
+			}
+			if opts.IdempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", opts.IdempotencyKey)
+			}
+			if signer != nil {
+				if err := signRequest(req, signer, payloadBody, time.Now()); err != nil {
+					return nil, err
+				}
+			}
 
-			resp, err := c.httpClient.Do(req)
+			trace.attempts++
+			start := time.Now()
+			resp, err := c.clientFor(apiURL).Do(req)
 			if err != nil {
+				if errors.Is(err, ErrPinMismatch) {
+					return nil, fmt.Errorf("request failed: %w", err)
+				}
 				lastErr = fmt.Errorf("request failed: %w", err)
 				continue
 			}
 
 			body, err := io.ReadAll(resp.Body)
 			resp.Body.Close()
+			trace.latency = time.Since(start)
 			if err != nil {
 				lastErr = fmt.Errorf("failed to read response body: %w", err)
 				continue
 			}
 
 			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-				return nil
+				tokenSlot := TokenSlotCurrent
+				if tokenIndex > 0 {
+					tokenSlot = TokenSlotGrace
+				}
+				trace.tokenSlot = tokenSlot
+				trace.encoding = encoding
+				trace.sent = len(payloadBody)
+				return &Response{StatusCode: resp.StatusCode, Body: body, TokenSlot: tokenSlot}, nil
+			}
+
+			// A 415 means the server cannot decode this Content-Encoding;
+			// resend immediately with a downgraded encoding without
+			// consuming a retry.
+			if resp.StatusCode == http.StatusUnsupportedMediaType && encoding != EncodingIdentity {
+				encoding = c.downgradeEncoding(apiURL, encoding, resp.Header.Get("Accept-Encoding"))
+				payloadBody, err = encodeBody(jsonData, encoding)
+				if err != nil {
+					return nil, err
+				}
+				attempt--
+				skipDelay = true
+				continue
 			}
 
 			if resp.StatusCode == 401 || resp.StatusCode == 403 {
-				if tokenIndex == 0 && c.config.TokenGrace != "" {
+				if tokenIndex < len(tokens)-1 {
 					lastErr = fmt.Errorf("authentication failed: HTTP %d", resp.StatusCode)
 					break
 				}
-				return fmt.Errorf("authentication failed: HTTP %d", resp.StatusCode)
+				return nil, fmt.Errorf("authentication failed: HTTP %d", resp.StatusCode)
 			}
 
 			if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-				return fmt.Errorf("client error: HTTP %d: %s", resp.StatusCode, string(body))
+				return nil, fmt.Errorf("client error: HTTP %d: %s", resp.StatusCode, string(body))
 			}
 
 			lastErr = fmt.Errorf("server error: HTTP %d: %s", resp.StatusCode, string(body))
@@ -215,5 +581,5 @@ func (c *Client) sendToURL(ctx context.Context, apiURL string, jsonData []byte,
 		break
 	}
 
-	return lastErr
+	return nil, lastErr
 }
@@ -1,10 +1,18 @@
 package transport
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -337,3 +345,630 @@ func TestSendHeartbeatNoFallbackOnClientError(t *testing.T) {
 		t.Errorf("expected fallback attempts=0, got %d", fallbackAttempts.Load())
 	}
 }
+
+func TestSPKIPinMatch(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:            []string{server.URL},
+		TokenCurrent:       "test-token",
+		InsecureSkipVerify: true,
+		SPKIPins: map[string][]string{
+			server.URL: {"sha256/" + SPKIPin(server.Certificate())},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	err = client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{})
+	if err != nil {
+		t.Errorf("expected success with matching pin, got %v", err)
+	}
+}
+
+func TestSPKIPinMismatchNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	wrongPin := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	client, err := New(Config{
+		APIURLs:            []string{server.URL},
+		TokenCurrent:       "current-token",
+		TokenGrace:         "grace-token",
+		InsecureSkipVerify: true,
+		SPKIPins: map[string][]string{
+			server.URL: {wrongPin},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	sleeper := &MockSleeper{}
+	err = client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, sleeper)
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected ErrPinMismatch, got %v", err)
+	}
+
+	if attempts.Load() != 0 {
+		t.Errorf("expected no requests to reach the server, got %d", attempts.Load())
+	}
+	if len(sleeper.sleeps) != 0 {
+		t.Errorf("expected no retries on pin mismatch, got %d sleeps", len(sleeper.sleeps))
+	}
+}
+
+func TestSPKIPinMismatchDoesNotFallBack(t *testing.T) {
+	var fallbackAttempts atomic.Int32
+	primary := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackAttempts.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fallback.Close()
+
+	client, err := New(Config{
+		APIURLs:            []string{primary.URL, fallback.URL},
+		TokenCurrent:       "test-token",
+		InsecureSkipVerify: true,
+		SPKIPins: map[string][]string{
+			primary.URL: {base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	err = client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{})
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected ErrPinMismatch, got %v", err)
+	}
+	if fallbackAttempts.Load() != 0 {
+		t.Errorf("expected no fallback after pin mismatch, got %d attempts", fallbackAttempts.Load())
+	}
+}
+
+func TestFetchUsesPinsOfSameHost(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	wrongPin := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	client, err := New(Config{
+		APIURLs:            []string{server.URL + "/v1/heartbeat"},
+		TokenCurrent:       "test-token",
+		InsecureSkipVerify: true,
+		SPKIPins: map[string][]string{
+			server.URL + "/v1/heartbeat": {wrongPin},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	_, err = client.Fetch(context.Background(), server.URL+"/v1/config", nil)
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected ErrPinMismatch, got %v", err)
+	}
+	if attempts.Load() != 0 {
+		t.Errorf("expected no requests to reach the server, got %d", attempts.Load())
+	}
+}
+
+func TestVerifyPinsIgnoresAppendedCertificates(t *testing.T) {
+	leaf := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("leaf key")}
+	pinned := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("pinned key")}
+	pins := []string{SPKIPin(pinned)}
+
+	// Without verification nothing vouches for certificates after the leaf.
+	appended := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, pinned}}
+	if err := verifyPins(appended, "https://api.example.com", pins); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("expected appended pinned certificate to be rejected, got %v", err)
+	}
+
+	verified := tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{leaf, pinned},
+		VerifiedChains:   [][]*x509.Certificate{{leaf, pinned}},
+	}
+	if err := verifyPins(verified, "https://api.example.com", pins); err != nil {
+		t.Errorf("expected pinned certificate in verified chain to match, got %v", err)
+	}
+
+	if err := verifyPins(appended, "https://api.example.com", []string{SPKIPin(leaf)}); err != nil {
+		t.Errorf("expected pinned leaf to match, got %v", err)
+	}
+}
+
+func TestPinnedTLSConfigUsesPinsOfSameHost(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	get := func(pins map[string][]string) error {
+		tlsConfig, err := NewPinnedTLSConfig("", true, pins, server.URL+"/v1/enroll")
+		if err != nil {
+			t.Fatalf("failed to build TLS config: %v", err)
+		}
+		resp, err := NewHTTPClient(tlsConfig, 5*time.Second).Get(server.URL + "/v1/enroll")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	wrongPin := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	if err := get(map[string][]string{server.URL + "/v1/heartbeat": {wrongPin}}); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("expected ErrPinMismatch for pinned host, got %v", err)
+	}
+	if err := get(map[string][]string{server.URL: {SPKIPin(server.Certificate())}}); err != nil {
+		t.Errorf("expected matching pin to succeed, got %v", err)
+	}
+	if err := get(map[string][]string{"https://other.example.com": {wrongPin}}); err != nil {
+		t.Errorf("expected unpinned host to succeed, got %v", err)
+	}
+
+	// Pins of every api url on the host apply, whatever the map order.
+	sameHost := map[string][]string{
+		server.URL + "/v1/heartbeat": {wrongPin},
+		server.URL + "/v2/heartbeat": {SPKIPin(server.Certificate())},
+	}
+	for i := 0; i < 10; i++ {
+		if err := get(sameHost); err != nil {
+			t.Fatalf("expected pins of both same-host urls to be accepted, got %v", err)
+		}
+	}
+}
+
+func TestSPKIPinsRejectUnknownURL(t *testing.T) {
+	_, err := New(Config{
+		APIURLs:      []string{"https://api.example.com"},
+		TokenCurrent: "test-token",
+		SPKIPins: map[string][]string{
+			"https://other.example.com": {base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		},
+	})
+	if err == nil {
+		t.Error("expected error for pins on unknown url")
+	}
+}
+
+func TestSendHeartbeatGzipCompression(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected Content-Encoding gzip, got %q", r.Header.Get("Content-Encoding"))
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("failed to open gzip body: %v", err)
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(zr).Decode(&payload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		if payload["uuid"] != "test-uuid" {
+			t.Errorf("expected uuid=test-uuid, got %v", payload["uuid"])
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:             []string{server.URL},
+		TokenCurrent:        "test-token",
+		Compression:         EncodingGzip,
+		CompressionMinBytes: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if client.Stats() != nil {
+		t.Error("expected no stats before first send")
+	}
+
+	payload := map[string]interface{}{"uuid": "test-uuid", "padding": strings.Repeat("a", 2048)}
+	err = client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	stats := client.Stats()
+	if stats == nil {
+		t.Fatal("expected stats after send")
+	}
+	if stats.ContentEncoding != EncodingGzip {
+		t.Errorf("expected content_encoding=gzip, got %s", stats.ContentEncoding)
+	}
+	if stats.SentBytes >= stats.UncompressedBytes {
+		t.Errorf("expected compressed size < uncompressed, got %d >= %d", stats.SentBytes, stats.UncompressedBytes)
+	}
+}
+
+func TestSendHeartbeatBelowCompressionThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enc := r.Header.Get("Content-Encoding"); enc != "" {
+			t.Errorf("expected no Content-Encoding below threshold, got %q", enc)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+		Compression:  EncodingZstd,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats := client.Stats(); stats.ContentEncoding != EncodingIdentity {
+		t.Errorf("expected identity encoding, got %s", stats.ContentEncoding)
+	}
+}
+
+func TestSendHeartbeatFallsBackToIdentityOn415(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:             []string{server.URL},
+		TokenCurrent:        "test-token",
+		Compression:         EncodingZstd,
+		CompressionMinBytes: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	sleeper := &MockSleeper{}
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, sleeper); err != nil {
+		t.Fatalf("expected success after identity fallback, got %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts.Load())
+	}
+	if len(sleeper.sleeps) != 0 {
+		t.Errorf("expected no backoff for encoding fallback, got %d sleeps", len(sleeper.sleeps))
+	}
+
+	// The downgrade is remembered for subsequent sends.
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, sleeper); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("expected 3 attempts in total, got %d", attempts.Load())
+	}
+}
+
+func TestSendHeartbeatZstdDowngradesToAcceptedGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Accept-Encoding", "gzip")
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:             []string{server.URL},
+		TokenCurrent:        "test-token",
+		Compression:         EncodingZstd,
+		CompressionMinBytes: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if stats := client.Stats(); stats.ContentEncoding != EncodingGzip {
+		t.Errorf("expected gzip after negotiation, got %s", stats.ContentEncoding)
+	}
+}
+
+func TestIdempotencyKeyReusedAcrossRetries(t *testing.T) {
+	var attempts atomic.Int32
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	opts := SendOptions{IdempotencyKey: "session-1-5"}
+	if _, err := client.SendHeartbeatWithOptions(context.Background(), payload, opts, DefaultRetryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(keys))
+	}
+	for i, key := range keys {
+		if key != "session-1-5" {
+			t.Errorf("attempt %d: expected Idempotency-Key session-1-5, got %q", i, key)
+		}
+	}
+}
+
+func TestSendDiagnostics(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer grace-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fallback.Close()
+
+	client, err := New(Config{
+		APIURLs:      []string{primary.URL, fallback.URL},
+		TokenCurrent: "current-token",
+		TokenGrace:   "grace-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	retryConfig := RetryConfig{MaxRetries: 1, Delays: []time.Duration{time.Second}}
+	payload := map[string]interface{}{"uuid": "test"}
+	if err := client.SendHeartbeat(context.Background(), payload, retryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	stats := client.Stats()
+	if stats.EndpointIndex != 1 {
+		t.Errorf("expected endpoint_index=1, got %d", stats.EndpointIndex)
+	}
+	if stats.TokenSlot != TokenSlotGrace {
+		t.Errorf("expected token_slot=grace, got %s", stats.TokenSlot)
+	}
+	// Primary: initial attempt and 1 retry. Fallback: current token
+	// rejected, grace accepted.
+	if stats.Attempts != 4 {
+		t.Errorf("expected 4 attempts, got %d", stats.Attempts)
+	}
+	if stats.Retries != 1 {
+		t.Errorf("expected 1 retry, got %d", stats.Retries)
+	}
+	if stats.Fallbacks != 1 {
+		t.Errorf("expected 1 fallback, got %d", stats.Fallbacks)
+	}
+
+	if err := client.SendHeartbeat(context.Background(), payload, RetryConfig{MaxRetries: 0}, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	totals := client.Stats().Totals
+	if totals.Sends != 2 || totals.Failures != 0 {
+		t.Errorf("expected 2 sends and 0 failures, got %+v", totals)
+	}
+	if totals.GraceTokenSends != 2 || totals.FallbackURLSends != 2 {
+		t.Errorf("expected grace and fallback counters of 2, got %+v", totals)
+	}
+	if totals.Fallbacks != 2 {
+		t.Errorf("expected 2 fallbacks in total, got %d", totals.Fallbacks)
+	}
+}
+
+type testSigner struct {
+	key ed25519.PrivateKey
+}
+
+func (s testSigner) KeyID() string              { return "test-key" }
+func (s testSigner) Sign(message []byte) []byte { return ed25519.Sign(s.key, message) }
+
+func TestSignedRequests(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts atomic.Int32
+	var nonces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderKeyID) != "test-key" {
+			t.Errorf("unexpected key id %q", r.Header.Get(HeaderKeyID))
+		}
+		sig, err := base64.StdEncoding.DecodeString(r.Header.Get(HeaderSignature))
+		if err != nil {
+			t.Errorf("invalid signature encoding: %v", err)
+		}
+		msg := SigningMessage(r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce), body)
+		if !ed25519.Verify(pub, msg, sig) {
+			t.Error("signature did not verify")
+		}
+		nonces = append(nonces, r.Header.Get(HeaderNonce))
+		if attempts.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:      []string{server.URL},
+		TokenCurrent: "test-token",
+		Signer:       testSigner{key: priv},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	payload := map[string]interface{}{"uuid": "test"}
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(nonces) != 2 || nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Errorf("expected a fresh nonce per attempt, got %v", nonces)
+	}
+}
+
+func TestReconfigureKeepsTokensAndStats(t *testing.T) {
+	var oldHits, newHits atomic.Int32
+	var newAuth string
+	oldServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oldHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer oldServer.Close()
+	newServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newHits.Add(1)
+		newAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer newServer.Close()
+
+	client, err := New(Config{
+		APIURLs:      []string{oldServer.URL},
+		TokenCurrent: "config-token",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.SetTokens("rotated-token", "")
+
+	payload := map[string]interface{}{"uuid": "test"}
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if err := client.Reconfigure(Config{APIURLs: []string{newServer.URL}, Compression: "brotli"}); err == nil {
+		t.Fatal("expected invalid compression to be rejected")
+	}
+	if err := client.Reconfigure(Config{APIURLs: []string{newServer.URL}, TokenCurrent: "ignored"}); err != nil {
+		t.Fatalf("reconfigure failed: %v", err)
+	}
+	if err := client.SendHeartbeat(context.Background(), payload, DefaultRetryConfig, &MockSleeper{}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if oldHits.Load() != 1 || newHits.Load() != 1 {
+		t.Errorf("expected one request per server, got old=%d new=%d", oldHits.Load(), newHits.Load())
+	}
+	if newAuth != "Bearer rotated-token" {
+		t.Errorf("expected rotated token to survive reconfigure, got %q", newAuth)
+	}
+	if stats := client.Stats(); stats == nil || stats.Totals.Sends != 2 {
+		t.Errorf("expected totals to survive reconfigure, got %+v", stats)
+	}
+}
+
+func TestFetchFallsBackToGraceAndSigns(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var auths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("expected GET, got %s", r.Method)
+		}
+		sig, _ := base64.StdEncoding.DecodeString(r.Header.Get(HeaderSignature))
+		if !ed25519.Verify(pub, SigningMessage(r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce), nil), sig) {
+			t.Error("signature did not verify")
+		}
+		auths = append(auths, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer grace-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"7"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"version":7}`))
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		APIURLs:      []string{server.URL + "/heartbeat"},
+		TokenCurrent: "current-token",
+		TokenGrace:   "grace-token",
+		Signer:       testSigner{key: priv},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	resp, err := client.Fetch(context.Background(), server.URL+"/config", nil)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != `{"version":7}` || resp.TokenSlot != TokenSlotGrace {
+		t.Errorf("unexpected response %d %q slot=%s", resp.StatusCode, resp.Body, resp.TokenSlot)
+	}
+	if len(auths) != 2 || auths[0] != "Bearer current-token" {
+		t.Errorf("expected current then grace token, got %v", auths)
+	}
+
+	resp, err = client.Fetch(context.Background(), server.URL+"/config", http.Header{"If-None-Match": {`"7"`}})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", resp.StatusCode)
+	}
+
+	client.SetTokens("current-token", "")
+	if _, err := client.Fetch(context.Background(), server.URL+"/config", nil); err == nil {
+		t.Error("expected authentication error without a working token")
+	}
+}
@@ -12,6 +12,7 @@ fi
 INSTALL_DIR="/opt/gw-agent"
 CONFIG_DIR="/etc/gw-agent"
 LOG_DIR="/var/log/gw-agent"
+DATA_DIR="/var/lib/gw-agent"
 BINARY_NAME="gw-agent"
 SERVICE_USER="gwagent"
 SERVICE_NAME="gw-agent"
@@ -24,6 +25,9 @@ case $ARCH in
     aarch64|arm64)
         DIST_DIR="linux_arm64"
         ;;
+    armv6l|armv7l)
+        DIST_DIR="linux_arm"
+        ;;
     *)
         echo "Error: Unsupported architecture: $ARCH"
         exit 1
@@ -49,7 +53,9 @@ fi
 echo "Creating directories..."
 mkdir -p "$INSTALL_DIR"
 mkdir -p "$CONFIG_DIR"
+mkdir -p "$CONFIG_DIR/conf.d"
 mkdir -p "$LOG_DIR"
+mkdir -p "$DATA_DIR"
 
 echo "Installing binary..."
 cp "$BINARY_PATH" "$INSTALL_DIR/$BINARY_NAME"
@@ -91,6 +97,8 @@ else
 fi
 
 chown "$SERVICE_USER:$SERVICE_USER" "$LOG_DIR"
+chown "$SERVICE_USER:$SERVICE_USER" "$DATA_DIR"
+chmod 700 "$DATA_DIR"
 
 echo "Installing systemd service..."
 cp ./scripts/gw-agent.service /etc/systemd/system/
@@ -100,6 +108,7 @@ echo "Installation complete!"
 echo ""
 echo "Next steps:"
 echo "1. Edit the configuration file: $CONFIG_DIR/config.yaml"
+echo "   (or enroll: sudo -u $SERVICE_USER $INSTALL_DIR/$BINARY_NAME enroll --config $CONFIG_DIR/config.yaml --code <code>)"
 echo "2. Enable the service: systemctl enable $SERVICE_NAME"
 echo "3. Start the service: systemctl start $SERVICE_NAME"
 echo "4. Check status: systemctl status $SERVICE_NAME"